@@ -0,0 +1,256 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"lsf_exporter/config"
+)
+
+// LSF job states of the jStatus field of JOB_FINISH records.
+const (
+	lsbJobStatusExit = 0x20
+	lsbJobStatusDone = 0x40
+)
+
+// acctRecord holds the fields of a JOB_FINISH record of lsb.acct.
+type acctRecord struct {
+	JobID         int64
+	Index         int64
+	User          string
+	Queue         string
+	Project       string
+	Application   string
+	NumProcessors int64
+	StartTime     int64
+	EndTime       int64
+	Status        int64
+	// CPUTime is the user and system CPU time, in seconds.
+	CPUTime float64
+	// ExitStatus is the wait status of the job.
+	ExitStatus int64
+}
+
+// exitCode returns the exit code of the job, or 128 plus the signal number
+// when the job was killed by a signal, as shells report it.
+func (r *acctRecord) exitCode() int64 {
+	if sig := r.ExitStatus & 0x7f; sig != 0 {
+		return 128 + sig
+	}
+	return (r.ExitStatus >> 8) & 0xff
+}
+
+// wallTime returns how long the job ran, in seconds.
+func (r *acctRecord) wallTime() float64 {
+	if r.StartTime <= 0 || r.EndTime < r.StartTime {
+		return 0
+	}
+	return float64(r.EndTime - r.StartTime)
+}
+
+// parseJobFinish parses the fields of a JOB_FINISH record, as documented in
+// lsb.acct(5).
+func parseJobFinish(fields []string) (*acctRecord, error) {
+	f := &lsbFields{fields: fields}
+	r := &acctRecord{}
+
+	f.skip(3) // event type, version, event time
+	r.JobID = f.int()
+	f.skip(2) // userId, options
+	r.NumProcessors = f.int()
+	f.skip(2) // submitTime, beginTime
+	r.EndTime = f.int()
+	r.StartTime = f.int()
+	r.User = f.str()
+	r.Queue = f.str()
+	f.skip(9)    // resReq ... jobFile
+	f.skipList() // askedHosts
+	f.skipList() // execHosts
+	r.Status = f.int()
+	f.skip(3) // hostFactor, jobName, command
+	utime := f.float()
+	stime := f.float()
+	f.skip(17) // ru_maxrss ... ru_exutime
+	f.skip(1)  // mailUser
+	r.Project = f.str()
+	r.ExitStatus = f.int()
+	f.skip(3) // maxNumProcessors, loginShell, timeEvent
+	r.Index = f.int()
+	f.skip(13) // maxRMem ... licenseProject
+	r.Application = f.str()
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	// rusage values are -1 when they are not available.
+	r.CPUTime = math.Max(utime, 0) + math.Max(stime, 0)
+	return r, nil
+}
+
+type acctKey struct {
+	queue, user, project, solver string
+}
+
+type acctTotals struct {
+	done, exited                   float64
+	exitCodes                      map[int64]float64
+	cpuSeconds, wallSeconds, slots float64
+}
+
+type acctCollector struct {
+	FinishedJobs *prometheus.Desc
+	ExitCodes    *prometheus.Desc
+	CPUSeconds   *prometheus.Desc
+	WallSeconds  *prometheus.Desc
+	SlotSeconds  *prometheus.Desc
+	logger       *slog.Logger
+	config       *config.Configuration
+	solvers      solverMapper
+	*acctState
+}
+
+// acctState is the state of the acct collector, handed over on reload.
+type acctState struct {
+	mtx    sync.Mutex
+	tailer *logTailer
+	totals map[acctKey]*acctTotals
+}
+
+func init() {
+	registerCollector("acct", defaultDisabled, NewAcctCollector)
+}
+
+// NewAcctCollector returns a new Collector exposing the jobs finished since
+// the exporter started, read from lsb.acct.
+func NewAcctCollector(logger *slog.Logger, config *config.Configuration) (Collector, error) {
+	labels := []string{"queue", "user", "project", "solver"}
+	return &acctCollector{
+		FinishedJobs: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "acct", "finished_jobs_total"),
+			"Number of finished jobs read from lsb.acct, by final status.",
+			append(labels, "status"), nil,
+		),
+		ExitCodes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "acct", "exit_codes_total"),
+			"Number of finished jobs read from lsb.acct, by exit code.",
+			append(labels, "exit_code"), nil,
+		),
+		CPUSeconds: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "acct", "cpu_seconds_total"),
+			"User and system CPU time consumed by the finished jobs.",
+			labels, nil,
+		),
+		WallSeconds: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "acct", "wall_seconds_total"),
+			"Run time of the finished jobs.",
+			labels, nil,
+		),
+		SlotSeconds: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "acct", "slot_seconds_total"),
+			"Run time of the finished jobs multiplied by their number of slots.",
+			labels, nil,
+		),
+		logger:  logger,
+		config:  config,
+		solvers: newSolverMapper(config),
+		acctState: &acctState{
+			totals: map[acctKey]*acctTotals{},
+		},
+	}, nil
+}
+
+// inherit implements stateInheritor. The totals are kept, and so is the
+// offset in lsb.acct unless the reload changed the file to read.
+func (c *acctCollector) inherit(prev Collector) {
+	p, ok := prev.(*acctCollector)
+	if !ok {
+		return
+	}
+	c.acctState = p.acctState
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if !sameLogFile(p.config, c.config, p.config.Accounting, c.config.Accounting) {
+		c.tailer = nil
+	}
+}
+
+// Update reads the records appended to lsb.acct since the last call and
+// exports the totals.
+func (c *acctCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	err := c.readAcct(ctx)
+	c.collectTotals(ch)
+	if err != nil {
+		return fmt.Errorf("couldn't read lsb.acct: %w", err)
+	}
+	return nil
+}
+
+func (c *acctCollector) readAcct(ctx context.Context) error {
+	if c.tailer == nil {
+		tailer, err := newLogTailer(c.logger, c.config, c.config.Accounting, "lsb.acct")
+		if err != nil {
+			return err
+		}
+		c.tailer = tailer
+	}
+
+	return c.tailer.read(ctx, func(line string) {
+		if !strings.HasPrefix(line, `"JOB_FINISH"`) {
+			return
+		}
+		fields, err := splitLSBRecord(line)
+		var r *acctRecord
+		if err == nil {
+			r, err = parseJobFinish(fields)
+		}
+		if err != nil {
+			c.logger.Warn("Couldn't parse lsb.acct record", "err", err)
+			parseErrorsTotal.WithLabelValues("acct").Inc()
+			return
+		}
+		c.add(r)
+	})
+}
+
+func (c *acctCollector) add(r *acctRecord) {
+	k := acctKey{r.Queue, r.User, r.Project, c.solvers.solver(r.Application, r.Queue)}
+	t := c.totals[k]
+	if t == nil {
+		t = &acctTotals{exitCodes: map[int64]float64{}}
+		c.totals[k] = t
+	}
+
+	switch {
+	case r.Status&lsbJobStatusDone != 0:
+		t.done++
+	case r.Status&lsbJobStatusExit != 0:
+		t.exited++
+	}
+	t.exitCodes[r.exitCode()]++
+	t.cpuSeconds += r.CPUTime
+	t.wallSeconds += r.wallTime()
+	t.slots += r.wallTime() * float64(r.NumProcessors)
+}
+
+func (c *acctCollector) collectTotals(ch chan<- prometheus.Metric) {
+	for k, t := range c.totals {
+		labels := []string{k.queue, k.user, k.project, k.solver}
+		ch <- prometheus.MustNewConstMetric(c.FinishedJobs, prometheus.CounterValue, t.done, append(labels, "done")...)
+		ch <- prometheus.MustNewConstMetric(c.FinishedJobs, prometheus.CounterValue, t.exited, append(labels, "exit")...)
+		for code, n := range t.exitCodes {
+			ch <- prometheus.MustNewConstMetric(c.ExitCodes, prometheus.CounterValue, n, append(labels, fmt.Sprint(code))...)
+		}
+		ch <- prometheus.MustNewConstMetric(c.CPUSeconds, prometheus.CounterValue, t.cpuSeconds, labels...)
+		ch <- prometheus.MustNewConstMetric(c.WallSeconds, prometheus.CounterValue, t.wallSeconds, labels...)
+		ch <- prometheus.MustNewConstMetric(c.SlotSeconds, prometheus.CounterValue, t.slots, labels...)
+	}
+}
@@ -2,6 +2,7 @@ package collector
 
 import (
 	"bytes"
+	"context"
 	"encoding/csv"
 	"fmt"
 	"io"
@@ -24,6 +25,7 @@ type bHostsCollector struct {
 	HostUSUSPJobCount *prometheus.Desc
 	HostStatus        *prometheus.Desc
 	logger            *slog.Logger
+	runner            config.CommandRunner
 }
 
 func init() {
@@ -65,18 +67,19 @@ func NewLSFbHostCollector(logger *slog.Logger, config *config.Configuration) (Co
 			[]string{"host_name"}, nil,
 		),
 		logger: logger,
+		runner: newCommandRunner(logger, config),
 	}, nil
 }
 
 // Update calls (*lmstatCollector).getLmStat to get the platform specific
 // memory metrics.
-func (c *bHostsCollector) Update(ch chan<- prometheus.Metric) error {
+func (c *bHostsCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	// err := c.getLmstatInfo(ch)
 	// if err != nil {
 	// 	return fmt.Errorf("couldn't get lmstat version information: %w", err)
 	// }
 
-	err := c.parsebHostJobCount(ch)
+	err := c.parsebHostJobCount(ctx, ch)
 
 	if err != nil {
 		return fmt.Errorf("couldn't get bhosts infomation: %w", err)
@@ -110,9 +113,10 @@ func bhost_CsvtoStruct(lsfOutput []byte, logger *slog.Logger) ([]bhostInfo, erro
 	csv_out.TrimLeadingSpace = true
 
 	dec, err := csvutil.NewDecoder(csv_out)
-	if err != nil {
-		logger.Error("Error decoding CSV", "err", err)
+	if err == io.EOF {
 		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error decoding CSV header: %w", err)
 	}
 
 	var bhostInfos []bhostInfo
@@ -122,8 +126,7 @@ func bhost_CsvtoStruct(lsfOutput []byte, logger *slog.Logger) ([]bhostInfo, erro
 		if err := dec.Decode(&u); err == io.EOF {
 			break
 		} else if err != nil {
-			logger.Error("Error decoding record", "err", err)
-			return nil, nil
+			return nil, fmt.Errorf("error decoding record: %w", err)
 		}
 
 		bhostInfos = append(bhostInfos, u)
@@ -149,16 +152,14 @@ func FormatbhostsStatus(status string, logger *slog.Logger) float64 {
 	}
 }
 
-func (c *bHostsCollector) parsebHostJobCount(ch chan<- prometheus.Metric) error {
-	output, err := lsfOutput(c.logger, "bhosts", "-w", "-X")
+func (c *bHostsCollector) parsebHostJobCount(ctx context.Context, ch chan<- prometheus.Metric) error {
+	output, err := c.runner.Run(ctx, "bhosts", "-w", "-X")
 	if err != nil {
-		c.logger.Error("Failed to get bhosts output", "err", err)
-		return nil
+		return err
 	}
 	bhosts, err := bhost_CsvtoStruct(output, c.logger)
 	if err != nil {
-		c.logger.Error("Failed to parse bhosts output", "err", err)
-		return nil
+		return newParseError("bhosts", "bhosts", err)
 	}
 
 	for _, bhost := range bhosts {
@@ -0,0 +1,262 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/jszwec/csvutil"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"lsf_exporter/config"
+)
+
+type jobGroupCollector struct {
+	Jobs      *prometheus.Desc
+	NJobs     *prometheus.Desc
+	Slots     *prometheus.Desc
+	NSlots    *prometheus.Desc
+	JobLimit  *prometheus.Desc
+	LimitUsed *prometheus.Desc
+	Info      *prometheus.Desc
+	logger    *slog.Logger
+	runner    config.CommandRunner
+}
+
+func init() {
+	registerCollector("bjgroup", defaultDisabled, NewJobGroupCollector)
+}
+
+// NewJobGroupCollector returns a new Collector exposing the job counts, slot
+// counts and limits of job groups, from bjgroup.
+func NewJobGroupCollector(logger *slog.Logger, config *config.Configuration) (Collector, error) {
+	labels := []string{"job_group", "parent"}
+	return &jobGroupCollector{
+		Jobs: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "jobgroup", "jobs"),
+			"Number of jobs in the job group and its subgroups, by state (PEND, RUN, SSUSP, USUSP, FINISH).",
+			append(labels, "state"), nil,
+		),
+		NJobs: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "jobgroup", "njobs"),
+			"Number of jobs in the job group and its subgroups (NJOBS).",
+			labels, nil,
+		),
+		Slots: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "jobgroup", "slots"),
+			"Number of slots used by the jobs of the job group and its subgroups, by state (PEND, RUN, SSUSP, USUSP, RSV).",
+			append(labels, "state"), nil,
+		),
+		NSlots: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "jobgroup", "nslots"),
+			"Number of slots used by the jobs of the job group and its subgroups (NSLOTS).",
+			labels, nil,
+		),
+		JobLimit: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "jobgroup", "job_limit"),
+			"Maximum number of running jobs of the job group (JLIMIT), when it has one.",
+			labels, nil,
+		),
+		LimitUsed: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "jobgroup", "job_limit_used"),
+			"Number of jobs of the job group counted against its job limit (JLIMIT).",
+			labels, nil,
+		),
+		Info: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "jobgroup", "info"),
+			"Owner of the job group and the service class (SLA) it is attached to, empty if none.",
+			append(labels, "owner", "sla"), nil,
+		),
+		logger: logger,
+		runner: newCommandRunner(logger, config),
+	}, nil
+}
+
+// Update exports the job counts of bjgroup -s and the slot counts of
+// bjgroup -N.
+func (c *jobGroupCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	if err := c.parseJobGroups(ctx, ch); err != nil {
+		return fmt.Errorf("couldn't get job group infomation: %w", err)
+	}
+	if err := c.parseJobGroupSlots(ctx, ch); err != nil {
+		return fmt.Errorf("couldn't get job group slots: %w", err)
+	}
+	return nil
+}
+
+// jobGroupParent returns the parent of a job group, "/" for the top-level
+// groups and "" for the root group itself.
+func jobGroupParent(group string) string {
+	if group == "/" || !strings.HasPrefix(group, "/") {
+		return ""
+	}
+	return path.Dir(strings.TrimSuffix(group, "/"))
+}
+
+// parseJobLimit splits a JLIMIT such as 5/10 into the number of jobs counted
+// against the limit and the limit, hasLimit being false for "-".
+func parseJobLimit(jlimit string) (used, limit float64, hasLimit bool, err error) {
+	u, l, ok := strings.Cut(jlimit, "/")
+	if !ok {
+		if jlimit == "-" {
+			return 0, 0, false, nil
+		}
+		return 0, 0, false, fmt.Errorf("invalid JLIMIT %q", jlimit)
+	}
+	if used, err = strconv.ParseFloat(u, 64); err != nil {
+		return 0, 0, false, fmt.Errorf("invalid JLIMIT %q: %w", jlimit, err)
+	}
+	if l == "-" {
+		return used, 0, false, nil
+	}
+	if limit, err = strconv.ParseFloat(l, 64); err != nil {
+		return 0, 0, false, fmt.Errorf("invalid JLIMIT %q: %w", jlimit, err)
+	}
+	return used, limit, true, nil
+}
+
+// jobGroupSLA returns the service class of a job group, bjgroup showing ()
+// for the groups attached to none.
+func jobGroupSLA(sla string) string {
+	if sla == "()" || sla == "-" {
+		return ""
+	}
+	return sla
+}
+
+func bjgroup_CsvtoStruct(lsfOutput []byte, logger *slog.Logger) ([]bjgroupInfo, error) {
+	csv_out := csv.NewReader(TrimReader{bytes.NewReader(lsfOutput)})
+	csv_out.LazyQuotes = true
+	csv_out.Comma = ' '
+	csv_out.TrimLeadingSpace = true
+
+	dec, err := csvutil.NewDecoder(csv_out)
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error decoding CSV header: %w", err)
+	}
+
+	var groups []bjgroupInfo
+	for {
+		var g bjgroupInfo
+		if err := dec.Decode(&g); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("error decoding record: %w", err)
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+func bjgroupSlots_CsvtoStruct(lsfOutput []byte, logger *slog.Logger) ([]bjgroupSlotsInfo, error) {
+	csv_out := csv.NewReader(TrimReader{bytes.NewReader(lsfOutput)})
+	csv_out.LazyQuotes = true
+	csv_out.Comma = ' '
+	csv_out.TrimLeadingSpace = true
+
+	dec, err := csvutil.NewDecoder(csv_out)
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error decoding CSV header: %w", err)
+	}
+
+	var groups []bjgroupSlotsInfo
+	for {
+		var g bjgroupSlotsInfo
+		if err := dec.Decode(&g); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("error decoding record: %w", err)
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+func (c *jobGroupCollector) parseJobGroups(ctx context.Context, ch chan<- prometheus.Metric) error {
+	output, err := c.runner.Run(ctx, "bjgroup", "-s")
+	if isErrorKind(err, ErrorKindNoJobs) {
+		c.logger.Debug("No job group found")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	groups, err := bjgroup_CsvtoStruct(output, c.logger)
+	if err != nil {
+		return newParseError("bjgroup", "bjgroup", err)
+	}
+
+	var errs []error
+	for _, g := range groups {
+		parent := jobGroupParent(g.GROUP_NAME)
+		ch <- prometheus.MustNewConstMetric(c.NJobs, prometheus.GaugeValue, g.NJOBS, g.GROUP_NAME, parent)
+		for _, s := range []struct {
+			state string
+			n     float64
+		}{
+			{"PEND", g.PEND},
+			{"RUN", g.RUN},
+			{"SSUSP", g.SSUSP},
+			{"USUSP", g.USUSP},
+			{"FINISH", g.FINISH},
+		} {
+			ch <- prometheus.MustNewConstMetric(c.Jobs, prometheus.GaugeValue, s.n, g.GROUP_NAME, parent, s.state)
+		}
+		ch <- prometheus.MustNewConstMetric(c.Info, prometheus.GaugeValue, 1, g.GROUP_NAME, parent, g.OWNER, jobGroupSLA(g.SLA))
+
+		used, limit, hasLimit, err := parseJobLimit(g.JLIMIT)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.LimitUsed, prometheus.GaugeValue, used, g.GROUP_NAME, parent)
+		if hasLimit {
+			ch <- prometheus.MustNewConstMetric(c.JobLimit, prometheus.GaugeValue, limit, g.GROUP_NAME, parent)
+		}
+	}
+	if len(errs) > 0 {
+		return newParseError("bjgroup", "bjgroup", errors.Join(errs...))
+	}
+	return nil
+}
+
+func (c *jobGroupCollector) parseJobGroupSlots(ctx context.Context, ch chan<- prometheus.Metric) error {
+	output, err := c.runner.Run(ctx, "bjgroup", "-N")
+	if isErrorKind(err, ErrorKindNoJobs) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	groups, err := bjgroupSlots_CsvtoStruct(output, c.logger)
+	if err != nil {
+		return newParseError("bjgroup", "bjgroup", err)
+	}
+
+	for _, g := range groups {
+		parent := jobGroupParent(g.GROUP_NAME)
+		ch <- prometheus.MustNewConstMetric(c.NSlots, prometheus.GaugeValue, g.NSLOTS, g.GROUP_NAME, parent)
+		for _, s := range []struct {
+			state string
+			n     float64
+		}{
+			{"PEND", g.PEND},
+			{"RUN", g.RUN},
+			{"SSUSP", g.SSUSP},
+			{"USUSP", g.USUSP},
+			{"RSV", g.RSV},
+		} {
+			ch <- prometheus.MustNewConstMetric(c.Slots, prometheus.GaugeValue, s.n, g.GROUP_NAME, parent, s.state)
+		}
+	}
+	return nil
+}
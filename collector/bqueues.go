@@ -2,6 +2,7 @@ package collector
 
 import (
 	"bytes"
+	"context"
 	"encoding/csv"
 	"fmt"
 	"io"
@@ -22,6 +23,7 @@ type QueuesCollector struct {
 	queuesPriority        *prometheus.Desc
 	QueuesStatus          *prometheus.Desc
 	logger                *slog.Logger
+	runner                config.CommandRunner
 }
 
 func init() {
@@ -58,18 +60,19 @@ func NewLSFQueuesCollector(logger *slog.Logger, config *config.Configuration) (C
 			[]string{"queues_name"}, nil,
 		),
 		logger: logger,
+		runner: newCommandRunner(logger, config),
 	}, nil
 }
 
 // Update calls (*lmstatCollector).getLmStat to get the platform specific
 // memory metrics.
-func (c *QueuesCollector) Update(ch chan<- prometheus.Metric) error {
+func (c *QueuesCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	// err := c.getLmstatInfo(ch)
 	// if err != nil {
 	// 	return fmt.Errorf("couldn't get lmstat version information: %w", err)
 	// }
 
-	err := c.parseQueuesJobCount(ch)
+	err := c.parseQueuesJobCount(ctx, ch)
 	if err != nil {
 		return fmt.Errorf("couldn't get queues infomation: %w", err)
 	}
@@ -84,9 +87,10 @@ func bqueues_CsvtoStruct(lsfOutput []byte, logger *slog.Logger) ([]bqueuesInfo,
 	csv_out.TrimLeadingSpace = true
 
 	dec, err := csvutil.NewDecoder(csv_out)
-	if err != nil {
-		logger.Error("Error decoding CSV", "err", err)
+	if err == io.EOF {
 		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error decoding CSV header: %w", err)
 	}
 
 	var bqueuesInfos []bqueuesInfo
@@ -96,8 +100,7 @@ func bqueues_CsvtoStruct(lsfOutput []byte, logger *slog.Logger) ([]bqueuesInfo,
 		if err := dec.Decode(&u); err == io.EOF {
 			break
 		} else if err != nil {
-			logger.Error("Error decoding record", "err", err)
-			return nil, nil
+			return nil, fmt.Errorf("error decoding record: %w", err)
 		}
 
 		bqueuesInfos = append(bqueuesInfos, u)
@@ -124,16 +127,14 @@ func FormatQueusStatus(status string, logger *slog.Logger) float64 {
 	}
 }
 
-func (c *QueuesCollector) parseQueuesJobCount(ch chan<- prometheus.Metric) error {
-	output, err := lsfOutput(c.logger, "bqueues", "-w")
+func (c *QueuesCollector) parseQueuesJobCount(ctx context.Context, ch chan<- prometheus.Metric) error {
+	output, err := c.runner.Run(ctx, "bqueues", "-w")
 	if err != nil {
-		c.logger.Error("Failed to get bqueues output", "err", err)
-		return nil
+		return err
 	}
 	queues, err := bqueues_CsvtoStruct(output, c.logger)
 	if err != nil {
-		c.logger.Error("Failed to parse bqueues output", "err", err)
-		return nil
+		return newParseError("bqueues", "bqueues", err)
 	}
 
 	for _, q := range queues {
@@ -0,0 +1,251 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jszwec/csvutil"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"lsf_exporter/config"
+)
+
+type usersCollector struct {
+	MaxJobs     *prometheus.Desc
+	NJobs       *prometheus.Desc
+	Jobs        *prometheus.Desc
+	GroupMember *prometheus.Desc
+	logger      *slog.Logger
+	runner      config.CommandRunner
+}
+
+func init() {
+	registerCollector("busers", defaultDisabled, NewUsersCollector)
+}
+
+// NewUsersCollector returns a new Collector exposing the job counts of users
+// and user groups, from busers, and the members of user groups, from
+// bugroup.
+func NewUsersCollector(logger *slog.Logger, config *config.Configuration) (Collector, error) {
+	labels := []string{"user", "user_group"}
+	return &usersCollector{
+		MaxJobs: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "users", "max_jobs"),
+			"Maximum number of job slots the user or user group can use (MAX), when it has one.",
+			labels, nil,
+		),
+		NJobs: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "users", "njobs"),
+			"Number of tasks of the unfinished jobs of the user or user group (NJOBS).",
+			labels, nil,
+		),
+		Jobs: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "users", "jobs"),
+			"Number of tasks of the jobs of the user or user group, by state (PEND, RUN, SSUSP, USUSP, RSV).",
+			append(labels, "state"), nil,
+		),
+		GroupMember: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "user_group", "member_info"),
+			"Membership of a user in a user group, directly or through its subgroups.",
+			[]string{"user_group", "user"}, nil,
+		),
+		logger: logger,
+		runner: newCommandRunner(logger, config),
+	}, nil
+}
+
+// Update exports the members of the user groups of bugroup -w and the job
+// counts of busers -w all.
+func (c *usersCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	groups, err := c.parseUserGroups(ctx, ch)
+	if err != nil {
+		return fmt.Errorf("couldn't get user groups: %w", err)
+	}
+	if err := c.parseUsers(ctx, ch, groups); err != nil {
+		return fmt.Errorf("couldn't get users infomation: %w", err)
+	}
+	return nil
+}
+
+// parseUserGroupMembers returns the direct members of the user groups listed
+// by bugroup -w. The names of subgroups keep the / bugroup appends to them.
+// As both USERS and GROUP_ADMIN hold lists of names and bugroup doesn't keep
+// its columns aligned, GROUP_ADMIN is told apart as the trailing token of the
+// row, or the tokens from the one opening a parenthesized list of admins.
+func parseUserGroupMembers(out []byte) (map[string][]string, error) {
+	groups := map[string][]string{}
+	header, hasAdmin := false, false
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if !header {
+			if fields[0] != "GROUP_NAME" || len(fields) < 2 || fields[1] != "USERS" {
+				return nil, fmt.Errorf("unexpected bugroup header %q", scanner.Text())
+			}
+			header = true
+			for _, f := range fields[2:] {
+				hasAdmin = hasAdmin || f == "GROUP_ADMIN"
+			}
+			continue
+		}
+
+		users := fields[1:]
+		if hasAdmin && len(users) > 0 {
+			admin := len(users) - 1
+			for i, f := range users {
+				if strings.HasPrefix(f, "(") {
+					admin = i
+					break
+				}
+			}
+			users = users[:admin]
+		}
+		// bugroup shows the groups holding every user as "all users".
+		if len(users) == 2 && users[0] == "all" && users[1] == "users" {
+			users = users[:1]
+		}
+		groups[fields[0]] = users
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// expandUserGroup returns the users of a group and of its subgroups, sorted.
+func expandUserGroup(groups map[string][]string, group string) []string {
+	seen := map[string]bool{group: true}
+	users := map[string]bool{}
+	var expand func(g string)
+	expand = func(g string) {
+		for _, m := range groups[g] {
+			if sub, ok := strings.CutSuffix(m, "/"); ok {
+				if !seen[sub] {
+					seen[sub] = true
+					expand(sub)
+				}
+				continue
+			}
+			users[m] = true
+		}
+	}
+	expand(group)
+
+	list := make([]string, 0, len(users))
+	for u := range users {
+		list = append(list, u)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func (c *usersCollector) parseUserGroups(ctx context.Context, ch chan<- prometheus.Metric) (map[string][]string, error) {
+	output, err := c.runner.Run(ctx, "bugroup", "-w")
+	if isErrorKind(err, ErrorKindNoJobs) {
+		c.logger.Debug("No user group found")
+		return map[string][]string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	groups, err := parseUserGroupMembers(output)
+	if err != nil {
+		return nil, newParseError("busers", "bugroup", err)
+	}
+
+	for g := range groups {
+		for _, u := range expandUserGroup(groups, g) {
+			ch <- prometheus.MustNewConstMetric(c.GroupMember, prometheus.GaugeValue, 1, g, u)
+		}
+	}
+	return groups, nil
+}
+
+func busers_CsvtoStruct(lsfOutput []byte, logger *slog.Logger) ([]busersInfo, error) {
+	csv_out := csv.NewReader(TrimReader{bytes.NewReader(lsfOutput)})
+	csv_out.LazyQuotes = true
+	csv_out.Comma = ' '
+	csv_out.TrimLeadingSpace = true
+
+	dec, err := csvutil.NewDecoder(csv_out)
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error decoding CSV header: %w", err)
+	}
+
+	var users []busersInfo
+	for {
+		var u busersInfo
+		if err := dec.Decode(&u); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("error decoding record: %w", err)
+		}
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+// parseUsers exports the job counts of busers. A name is taken as a user
+// group when bugroup lists it, or when busers shows it with a trailing /.
+// The counts shown as - are left out.
+func (c *usersCollector) parseUsers(ctx context.Context, ch chan<- prometheus.Metric, groups map[string][]string) error {
+	output, err := c.runner.Run(ctx, "busers", "-w", "all")
+	if err != nil {
+		return err
+	}
+	users, err := busers_CsvtoStruct(output, c.logger)
+	if err != nil {
+		return newParseError("busers", "busers", err)
+	}
+
+	for _, u := range users {
+		name, isGroup := strings.CutSuffix(u.USER_GROUP, "/")
+		if _, ok := groups[name]; ok {
+			isGroup = true
+		}
+		user, group := name, ""
+		if isGroup {
+			user, group = "", name
+		}
+
+		for _, v := range []struct {
+			desc  *prometheus.Desc
+			state string
+			s     string
+		}{
+			{c.MaxJobs, "", u.MAX},
+			{c.NJobs, "", u.NJOBS},
+			{c.Jobs, "PEND", u.PEND},
+			{c.Jobs, "RUN", u.RUN},
+			{c.Jobs, "SSUSP", u.SSUSP},
+			{c.Jobs, "USUSP", u.USUSP},
+			{c.Jobs, "RSV", u.RSV},
+		} {
+			if v.s == "-" {
+				continue
+			}
+			n, err := strconv.ParseFloat(v.s, 64)
+			if err != nil {
+				return newParseError("busers", "busers", fmt.Errorf("invalid count %q for %s: %w", v.s, name, err))
+			}
+			if v.state == "" {
+				ch <- prometheus.MustNewConstMetric(v.desc, prometheus.GaugeValue, n, user, group)
+			} else {
+				ch <- prometheus.MustNewConstMetric(v.desc, prometheus.GaugeValue, n, user, group, v.state)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	lastSuccessDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scrape", "collector_last_success_timestamp_seconds"),
+		"lsf_exporter: Unix time of the last successful refresh of a polled collector.",
+		[]string{"collector"},
+		nil,
+	)
+	snapshotAgeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scrape", "collector_snapshot_age_seconds"),
+		"lsf_exporter: Age of the snapshot served for a polled collector.",
+		[]string{"collector"},
+		nil,
+	)
+
+	errNoSnapshot = errors.New("no successful refresh yet")
+)
+
+// cachedCollector runs a Collector in the background every interval and
+// serves the metrics of its last successful run, so that scrapes do not run
+// LSF commands themselves.
+type cachedCollector struct {
+	name      string
+	collector Collector
+	interval  time.Duration
+	logger    *slog.Logger
+	done      chan struct{}
+
+	mtx         sync.RWMutex
+	metrics     []prometheus.Metric
+	err         error
+	lastSuccess time.Time
+}
+
+// newCachedCollector wraps c and starts refreshing it in the background.
+func newCachedCollector(name string, c Collector, interval time.Duration, logger *slog.Logger) *cachedCollector {
+	cc := &cachedCollector{
+		name:      name,
+		collector: c,
+		interval:  interval,
+		logger:    logger,
+		done:      make(chan struct{}),
+		err:       errNoSnapshot,
+	}
+	go cc.run()
+	return cc
+}
+
+func (c *cachedCollector) run() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	c.refresh()
+	for {
+		select {
+		case <-ticker.C:
+			c.refresh()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// stop ends the background refresh. The last snapshot is still served.
+func (c *cachedCollector) stop() {
+	close(c.done)
+}
+
+// refresh runs the wrapped collector once and replaces the snapshot when it
+// succeeded. On failure the previous snapshot is kept.
+func (c *cachedCollector) refresh() {
+	ctx := context.Background()
+	if timeout := collectorTimeout(c.name); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	begin := time.Now()
+	metrics, err := updateMetrics(ctx, c.collector)
+	duration := time.Since(begin)
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("refresh timed out: %w", ctx.Err())
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if err != nil {
+		c.logger.Error("Collector refresh failed", "name", c.name, "duration", duration.Seconds(), "err", err)
+		c.err = err
+		return
+	}
+	c.logger.Debug("Collector refreshed", "name", c.name, "duration", duration.Seconds(), "metrics", len(metrics))
+	c.metrics = metrics
+	c.err = nil
+	c.lastSuccess = time.Now()
+}
+
+// Update implements Collector by sending the last snapshot. It returns the
+// error of the last refresh, if any.
+func (c *cachedCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	for _, m := range c.metrics {
+		ch <- m
+	}
+	if !c.lastSuccess.IsZero() {
+		ch <- prometheus.MustNewConstMetric(lastSuccessDesc, prometheus.GaugeValue, float64(c.lastSuccess.UnixNano())/1e9, c.name)
+		ch <- prometheus.MustNewConstMetric(snapshotAgeDesc, prometheus.GaugeValue, time.Since(c.lastSuccess).Seconds(), c.name)
+	}
+	return c.err
+}
@@ -0,0 +1,61 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// flakyCollector emits one gauge with the number of calls, and fails when
+// told to.
+type flakyCollector struct {
+	calls float64
+	fail  bool
+}
+
+var flakyDesc = prometheus.NewDesc("flaky_calls", "Number of calls.", nil, nil)
+
+func (c *flakyCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	c.calls++
+	if c.fail {
+		return errors.New("failed")
+	}
+	ch <- prometheus.MustNewConstMetric(flakyDesc, prometheus.GaugeValue, c.calls)
+	return nil
+}
+
+func TestCachedCollectorKeepsLastSnapshot(t *testing.T) {
+	flaky := &flakyCollector{}
+	cc := &cachedCollector{
+		name:      "flaky",
+		collector: flaky,
+		logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		err:       errNoSnapshot,
+	}
+
+	if err := cc.Update(context.Background(), make(chan prometheus.Metric, 10)); !errors.Is(err, errNoSnapshot) {
+		t.Fatalf("expected errNoSnapshot before the first refresh, got %v", err)
+	}
+
+	cc.refresh()
+	flaky.fail = true
+	cc.refresh()
+
+	ch := make(chan prometheus.Metric, 10)
+	if err := cc.Update(context.Background(), ch); err == nil {
+		t.Fatal("expected the error of the last refresh")
+	}
+	close(ch)
+
+	var descs []*prometheus.Desc
+	for m := range ch {
+		descs = append(descs, m.Desc())
+	}
+	if len(descs) != 3 || descs[0] != flakyDesc || descs[1] != lastSuccessDesc || descs[2] != snapshotAgeDesc {
+		t.Fatalf("expected the first snapshot and its staleness, got %v", descs)
+	}
+}
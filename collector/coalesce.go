@@ -0,0 +1,98 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/singleflight"
+
+	"lsf_exporter/config"
+)
+
+// CoalescingRunner wraps a config.CommandRunner so that identical commands
+// running at the same time share a single process and its output.
+type CoalescingRunner struct {
+	runner config.CommandRunner
+	group  singleflight.Group
+}
+
+// NewCoalescingRunner returns a CoalescingRunner delegating to runner.
+func NewCoalescingRunner(runner config.CommandRunner) *CoalescingRunner {
+	return &CoalescingRunner{runner: runner}
+}
+
+// detachedContext carries the values of its parent but neither its deadline
+// nor its cancellation, like context.WithoutCancel of Go 1.21.
+type detachedContext struct{ parent context.Context }
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+// sharedContext returns the context of work shared by several callers. It
+// does not end with the caller that started the work, which may give up
+// before the others, but after timeout, if any.
+func sharedContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(detachedContext{ctx}, timeout)
+	}
+	return context.WithCancel(detachedContext{ctx})
+}
+
+// Run runs the command, or waits for the identical command already in flight.
+// The shared command is bounded by the longest collector timeout rather than
+// by the context of the caller that started it; each caller gives up as soon
+// as its own context is done.
+func (r *CoalescingRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	leader := false
+	ch := r.group.DoChan(commandLine(name, args...), func() (interface{}, error) {
+		leader = true
+		sharedCtx, cancel := sharedContext(ctx, maxCollectorTimeout())
+		defer cancel()
+		return r.runner.Run(sharedCtx, name, args...)
+	})
+
+	select {
+	case res := <-ch:
+		if !leader {
+			commandCoalescedTotal.WithLabelValues(name).Inc()
+		}
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.([]byte), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// updateGroup coalesces concurrent updates of the same collector.
+var updateGroup singleflight.Group
+
+// coalescedUpdate runs c.Update, or waits for the update of the same
+// collector already in flight, and returns the metrics it produced. Sharing
+// the whole update also shares the parsing of the command output. The
+// shared update is bounded by the timeout of the collector, and each caller
+// gives up as soon as its own context is done.
+func coalescedUpdate(ctx context.Context, name string, c Collector) ([]prometheus.Metric, error) {
+	leader := false
+	ch := updateGroup.DoChan(name, func() (interface{}, error) {
+		leader = true
+		sharedCtx, cancel := sharedContext(ctx, collectorTimeout(name))
+		defer cancel()
+		return updateMetrics(sharedCtx, c)
+	})
+
+	select {
+	case res := <-ch:
+		if !leader {
+			collectorCoalescedTotal.WithLabelValues(name).Inc()
+		}
+		metrics, _ := res.Val.([]prometheus.Metric)
+		return metrics, res.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// blockingRunner runs commands that last until release is closed or their
+// context is done.
+type blockingRunner struct {
+	calls   int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func (r *blockingRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if atomic.AddInt32(&r.calls, 1) == 1 {
+		close(r.started)
+	}
+	select {
+	case <-r.release:
+		return []byte("output"), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// blockingCollector updates until release is closed or its context is done.
+type blockingCollector struct {
+	blockingRunner
+}
+
+func (c *blockingCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	if _, err := c.Run(ctx, "update"); err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, 1, "blocking")
+	return nil
+}
+
+// joinAndCancelLeader starts a call with a context that is cancelled once a
+// second call, with its own context, joined it. It returns the errors of the
+// first call and of the second.
+func joinAndCancelLeader(t *testing.T, r *blockingRunner, call func(ctx context.Context) error) (leaderErr, followerErr error) {
+	t.Helper()
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	leaderDone := make(chan error)
+	go func() { leaderDone <- call(leaderCtx) }()
+	<-r.started
+
+	followerDone := make(chan error)
+	go func() { followerDone <- call(context.Background()) }()
+	// Leave the second call the time to join the first.
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	leaderErr = <-leaderDone
+	close(r.release)
+	followerErr = <-followerDone
+	if calls := atomic.LoadInt32(&r.calls); calls != 1 {
+		t.Errorf("expected the calls to share a single run, got %d", calls)
+	}
+	return leaderErr, followerErr
+}
+
+func TestCoalescingRunnerOutlivesLeader(t *testing.T) {
+	r := &blockingRunner{started: make(chan struct{}), release: make(chan struct{})}
+	cr := NewCoalescingRunner(r)
+	var out []byte
+	leaderErr, followerErr := joinAndCancelLeader(t, r, func(ctx context.Context) error {
+		o, err := cr.Run(ctx, "bjobs", "-u", "all")
+		if ctx == context.Background() {
+			out = o
+		}
+		return err
+	})
+	if !errors.Is(leaderErr, context.Canceled) {
+		t.Errorf("expected the cancelled caller to give up, got %v", leaderErr)
+	}
+	if followerErr != nil || string(out) != "output" {
+		t.Errorf("expected the other caller to get the output, got %q, %v", out, followerErr)
+	}
+}
+
+func TestCoalescedUpdateOutlivesLeader(t *testing.T) {
+	c := &blockingCollector{blockingRunner{started: make(chan struct{}), release: make(chan struct{})}}
+	var metrics []prometheus.Metric
+	leaderErr, followerErr := joinAndCancelLeader(t, &c.blockingRunner, func(ctx context.Context) error {
+		m, err := coalescedUpdate(ctx, "blocking", c)
+		if ctx == context.Background() {
+			metrics = m
+		}
+		return err
+	})
+	if !errors.Is(leaderErr, context.Canceled) {
+		t.Errorf("expected the cancelled caller to give up, got %v", leaderErr)
+	}
+	if followerErr != nil || len(metrics) != 1 {
+		t.Errorf("expected the other caller to get the metrics, got %d metrics, %v", len(metrics), followerErr)
+	}
+}
@@ -16,6 +16,8 @@
 package collector
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"sync"
@@ -43,17 +45,24 @@ var (
 		[]string{"collector"},
 		nil,
 	)
+	scrapeTimeoutDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scrape", "collector_timeout"),
+		"lsf_exporter: Whether a collector failed because its timeout expired.",
+		[]string{"collector"},
+		nil,
+	)
 	scrapeErrorDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "scrape", "error"),
-		"lsf_exporter: Whether a license scrape had an error.",
+		"lsf_exporter: Set to 1 when a collector failed, labelled by the kind of error.",
 		[]string{"collector", "name"},
 		nil,
 	)
 )
 
 const (
-	defaultEnabled = true
-	upString       = "UP"
+	defaultEnabled  = true
+	defaultDisabled = false
+	upString        = "UP"
 )
 
 var (
@@ -62,8 +71,40 @@ var (
 	initiatedCollectors    = make(map[string]Collector)
 	collectorState         = make(map[string]*bool)
 	forcedCollectors       = map[string]bool{} // collectors which have been explicitly enabled or disabled
+	collectorTimeouts      = make(map[string]*time.Duration)
+	collectorIntervals     = make(map[string]*time.Duration)
+	// settingsMtx guards the values of collectorState, collectorTimeouts,
+	// collectorIntervals and the default flags, which ApplyConfig changes
+	// on reload.
+	settingsMtx = sync.RWMutex{}
+	// flagSettings holds the settings given by the flags, over which each
+	// configuration is applied. It is taken on the first ApplyConfig.
+	flagSettings     *settings
+	flagSettingsOnce sync.Once
+	// flagsSetByUser records the duration flags given on the command line,
+	// which win over the configuration file.
+	flagsSetByUser = make(map[string]*bool)
+	// retiredCollectors holds the collectors forgotten by ResetCollectors,
+	// whose state is handed over to the collectors created on reload.
+	retiredCollectors = make(map[string]Collector)
+
+	defaultCollectorTimeout = kingpin.Flag(
+		"collector.timeout",
+		"Default timeout for the LSF commands run by a collector. Use 0 to disable.",
+	).Default("30s").IsSetByUser(setByUser("collector.timeout")).Duration()
+	defaultCollectorInterval = kingpin.Flag(
+		"collector.interval",
+		"Default interval at which collectors refresh in the background; scrapes are then served from the last snapshot. Use 0 to run the LSF commands on every scrape.",
+	).Default("0s").IsSetByUser(setByUser("collector.interval")).Duration()
 )
 
+// setByUser returns the flag of flagsSetByUser for the named flag.
+func setByUser(flagName string) *bool {
+	b := new(bool)
+	flagsSetByUser[flagName] = b
+	return b
+}
+
 func registerCollector(collector string, isDefaultEnabled bool, factory func(logger *slog.Logger, config *config.Configuration) (Collector, error)) {
 
 	var helpDefaultState string
@@ -78,7 +119,17 @@ func registerCollector(collector string, isDefaultEnabled bool, factory func(log
 
 	flag := kingpin.Flag(flagName, flagHelp).Default(defaultValue).Action(collectorFlagAction(collector)).Bool()
 
+	timeoutFlagName := fmt.Sprintf("collector.%s.timeout", collector)
+	timeoutFlagHelp := fmt.Sprintf("Timeout for the %s collector. Use 0 to fall back to --collector.timeout.", collector)
+	timeout := kingpin.Flag(timeoutFlagName, timeoutFlagHelp).Default("0s").IsSetByUser(setByUser(timeoutFlagName)).Duration()
+
+	intervalFlagName := fmt.Sprintf("collector.%s.interval", collector)
+	intervalFlagHelp := fmt.Sprintf("Background refresh interval for the %s collector. Use 0 to fall back to --collector.interval.", collector)
+	interval := kingpin.Flag(intervalFlagName, intervalFlagHelp).Default("0s").IsSetByUser(setByUser(intervalFlagName)).Duration()
+
 	collectorState[collector] = flag
+	collectorTimeouts[collector] = timeout
+	collectorIntervals[collector] = interval
 	factories[collector] = factory
 }
 
@@ -86,6 +137,10 @@ func registerCollector(collector string, isDefaultEnabled bool, factory func(log
 type LsfCollector struct {
 	Collectors map[string]Collector
 	logger     *slog.Logger
+	// ctx bounds a whole Collect call, usually the context of the scrape
+	// request, whose deadline comes from X-Prometheus-Scrape-Timeout-Seconds.
+	// Nil means no bound.
+	ctx context.Context
 }
 
 // DisableDefaultCollectors sets the collector state to false for all collectors which
@@ -98,6 +153,98 @@ func DisableDefaultCollectors() {
 	}
 }
 
+// settings is a copy of the collector settings held by the flags.
+type settings struct {
+	state           map[string]bool
+	timeouts        map[string]time.Duration
+	intervals       map[string]time.Duration
+	defaultTimeout  time.Duration
+	defaultInterval time.Duration
+}
+
+func currentSettings() *settings {
+	s := &settings{
+		state:           make(map[string]bool),
+		timeouts:        make(map[string]time.Duration),
+		intervals:       make(map[string]time.Duration),
+		defaultTimeout:  *defaultCollectorTimeout,
+		defaultInterval: *defaultCollectorInterval,
+	}
+	for name := range collectorState {
+		s.state[name] = *collectorState[name]
+		s.timeouts[name] = *collectorTimeouts[name]
+		s.intervals[name] = *collectorIntervals[name]
+	}
+	return s
+}
+
+func (s *settings) restore() {
+	for name := range collectorState {
+		*collectorState[name] = s.state[name]
+		*collectorTimeouts[name] = s.timeouts[name]
+		*collectorIntervals[name] = s.intervals[name]
+	}
+	*defaultCollectorTimeout = s.defaultTimeout
+	*defaultCollectorInterval = s.defaultInterval
+}
+
+// ApplyConfig applies the collector settings of the configuration file,
+// except where the matching flag was given on the command line. It must be
+// called after DisableDefaultCollectors. Each call starts over from the
+// flags, so that applying a previous configuration again restores it.
+// Collectors already created keep running until ResetCollectors.
+func ApplyConfig(cfg *config.Configuration) error {
+	for name := range cfg.Collectors {
+		if _, ok := collectorState[name]; !ok {
+			return fmt.Errorf("unknown collector %q in configuration", name)
+		}
+	}
+	if err := validateJobsConfig(cfg.Jobs); err != nil {
+		return err
+	}
+
+	settingsMtx.Lock()
+	defer settingsMtx.Unlock()
+
+	flagSettingsOnce.Do(func() { flagSettings = currentSettings() })
+	flagSettings.restore()
+
+	applyDuration := func(flagName string, dst *time.Duration, value *time.Duration) {
+		if value != nil && !*flagsSetByUser[flagName] {
+			*dst = *value
+		}
+	}
+	applyDuration("collector.timeout", defaultCollectorTimeout, cfg.CollectorDefaults.Timeout)
+	applyDuration("collector.interval", defaultCollectorInterval, cfg.CollectorDefaults.Interval)
+
+	for name, cc := range cfg.Collectors {
+		if _, forced := forcedCollectors[name]; cc.Enabled != nil && !forced {
+			*collectorState[name] = *cc.Enabled
+		}
+		applyDuration(fmt.Sprintf("collector.%s.timeout", name), collectorTimeouts[name], cc.Timeout)
+		applyDuration(fmt.Sprintf("collector.%s.interval", name), collectorIntervals[name], cc.Interval)
+	}
+	return nil
+}
+
+// ResetCollectors stops the background refresh of the polled collectors and
+// forgets every collector created so far, so that the next NewLsfCollector
+// builds them again from the current configuration. The collectors keeping
+// state across scrapes hand it over to the new ones.
+func ResetCollectors() {
+	initiatedCollectorsMtx.Lock()
+	defer initiatedCollectorsMtx.Unlock()
+
+	for name, c := range initiatedCollectors {
+		if cc, ok := c.(*cachedCollector); ok {
+			cc.stop()
+			c = cc.collector
+		}
+		retiredCollectors[name] = c
+		delete(initiatedCollectors, name)
+	}
+}
+
 // collectorFlagAction generates a new action function for the given collector
 // to track whether it has been explicitly enabled or disabled from the command line.
 // A new action function is needed for each collector flag because the ParseContext
@@ -110,16 +257,71 @@ func collectorFlagAction(collector string) func(ctx *kingpin.ParseContext) error
 	}
 }
 
+// collectorStates returns whether each collector is enabled.
+func collectorStates() map[string]bool {
+	settingsMtx.RLock()
+	defer settingsMtx.RUnlock()
+
+	state := make(map[string]bool, len(collectorState))
+	for name, enabled := range collectorState {
+		state[name] = *enabled
+	}
+	return state
+}
+
+// collectorTimeout returns the timeout configured for the named collector.
+func collectorTimeout(name string) time.Duration {
+	settingsMtx.RLock()
+	defer settingsMtx.RUnlock()
+
+	if t, ok := collectorTimeouts[name]; ok && *t > 0 {
+		return *t
+	}
+	return *defaultCollectorTimeout
+}
+
+// maxCollectorTimeout returns the longest timeout of the enabled collectors,
+// 0 if one of them has none.
+func maxCollectorTimeout() time.Duration {
+	var longest time.Duration
+	for name, enabled := range collectorStates() {
+		if !enabled {
+			continue
+		}
+		t := collectorTimeout(name)
+		if t <= 0 {
+			return 0
+		}
+		if t > longest {
+			longest = t
+		}
+	}
+	return longest
+}
+
+// collectorInterval returns the background refresh interval configured for
+// the named collector, 0 if it runs on every scrape.
+func collectorInterval(name string) time.Duration {
+	settingsMtx.RLock()
+	defer settingsMtx.RUnlock()
+
+	if i, ok := collectorIntervals[name]; ok && *i > 0 {
+		return *i
+	}
+	return *defaultCollectorInterval
+}
+
 // NewLsfCollector creates a new LsfCollector.
 func NewLsfCollector(logger *slog.Logger, config *config.Configuration, filters ...string) (*LsfCollector, error) {
 	f := make(map[string]bool)
+	state := collectorStates()
 
 	for _, filter := range filters {
-		enabled, exist := collectorState[filter]
+		enabled, exist := state[filter]
 		if !exist {
 			return nil, fmt.Errorf("missing collector: %s", filter)
 		}
-		if !*enabled {
+		if !enabled {
 			return nil, fmt.Errorf("disabled collector: %s", filter)
 		}
 
@@ -131,8 +333,8 @@ func NewLsfCollector(logger *slog.Logger, config *config.Configuration, filters
 	initiatedCollectorsMtx.Lock()
 	defer initiatedCollectorsMtx.Unlock()
 
-	for key, enabled := range collectorState {
-		if !*enabled || (len(f) > 0 && !f[key]) {
+	for key, enabled := range state {
+		if !enabled || (len(f) > 0 && !f[key]) {
 			continue
 		}
 		if collector, ok := initiatedCollectors[key]; ok {
@@ -142,6 +344,15 @@ func NewLsfCollector(logger *slog.Logger, config *config.Configuration, filters
 			if err != nil {
 				return nil, err
 			}
+			if prev, ok := retiredCollectors[key]; ok {
+				if s, ok := collector.(stateInheritor); ok {
+					s.inherit(prev)
+				}
+				delete(retiredCollectors, key)
+			}
+			if interval := collectorInterval(key); interval > 0 {
+				collector = newCachedCollector(key, collector, interval, logger.With("collector", key))
+			}
 			collectors[key] = collector
 			initiatedCollectors[key] = collector
 		}
@@ -150,22 +361,37 @@ func NewLsfCollector(logger *slog.Logger, config *config.Configuration, filters
 	return &LsfCollector{Collectors: collectors, logger: logger}, nil
 }
 
+// WithContext returns a copy of n whose Collect runs under ctx, giving up
+// when it is done.
+func (n LsfCollector) WithContext(ctx context.Context) *LsfCollector {
+	n.ctx = ctx
+	return &n
+}
+
 // Describe implements the prometheus.Collector interface.
 func (n LsfCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- scrapeDurationDesc
 	ch <- scrapeSuccessDesc
+	ch <- scrapeTimeoutDesc
 	ch <- scrapeErrorDesc
+	ch <- lastSuccessDesc
+	ch <- snapshotAgeDesc
 }
 
 // Collect implements the prometheus.Collector interface.
 func (n LsfCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx := n.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
 	wg := sync.WaitGroup{}
 
 	wg.Add(len(n.Collectors))
 
 	for name, c := range n.Collectors {
 		go func(name string, c Collector) {
-			execute(name, c, ch, n.logger)
+			execute(ctx, name, c, ch, n.logger)
 			wg.Done()
 		}(name, c)
 	}
@@ -173,13 +399,27 @@ func (n LsfCollector) Collect(ch chan<- prometheus.Metric) {
 	wg.Wait()
 }
 
-func execute(name string, c Collector, ch chan<- prometheus.Metric, logger *slog.Logger) {
-	var success float64
+func execute(ctx context.Context, name string, c Collector, ch chan<- prometheus.Metric, logger *slog.Logger) {
+	var success, timedOut float64
+
+	if timeout := collectorTimeout(name); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
 	begin := time.Now()
-	err := c.Update(ch)
+	metrics, err := coalescedUpdate(ctx, name, c)
 	duration := time.Since(begin)
-	if err != nil {
+	for _, m := range metrics {
+		ch <- m
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) || errors.Is(err, context.DeadlineExceeded) {
+		logger.Error("Collector timed out", "name", name, "duration", duration.Seconds(), "err", err)
+
+		success = 0
+		timedOut = 1
+	} else if err != nil {
 		logger.Error("Collector failed", "name", name, "duration", duration.Seconds(), "err", err)
 
 		success = 0
@@ -189,10 +429,46 @@ func execute(name string, c Collector, ch chan<- prometheus.Metric, logger *slog
 	}
 	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration.Seconds(), name)
 	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, success, name)
+	ch <- prometheus.MustNewConstMetric(scrapeTimeoutDesc, prometheus.GaugeValue, timedOut, name)
+	if err != nil || timedOut == 1 {
+		kind := errorKind(err)
+		if timedOut == 1 {
+			kind = ErrorKindTimeout
+		}
+		ch <- prometheus.MustNewConstMetric(scrapeErrorDesc, prometheus.GaugeValue, 1, name, string(kind))
+	}
+}
+
+// updateMetrics runs c.Update and returns the metrics it sent.
+func updateMetrics(ctx context.Context, c Collector) ([]prometheus.Metric, error) {
+	ch := make(chan prometheus.Metric)
+	done := make(chan []prometheus.Metric)
+	go func() {
+		metrics := []prometheus.Metric{}
+		for m := range ch {
+			metrics = append(metrics, m)
+		}
+		done <- metrics
+	}()
+
+	err := c.Update(ctx, ch)
+	close(ch)
+	return <-done, err
+}
+
+// stateInheritor is implemented by the collectors keeping state across
+// scrapes, such as counters or read offsets, so that a reload does not reset
+// it.
+type stateInheritor interface {
+	// inherit takes over the state of prev, the collector of the same name
+	// created from the previous configuration. prev may still be running a
+	// scrape, so the state must be shared rather than copied.
+	inherit(prev Collector)
 }
 
 // Collector is the interface a collector has to implement.
 type Collector interface {
-	// Get new metrics and expose them via prometheus registry.
-	Update(ch chan<- prometheus.Metric) error
+	// Get new metrics and expose them via prometheus registry. LSF commands
+	// must be run under ctx so that they are killed when the scrape times out.
+	Update(ctx context.Context, ch chan<- prometheus.Metric) error
 }
@@ -0,0 +1,365 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/expfmt"
+
+	"lsf_exporter/config"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in fixtures/golden")
+
+// fixtureCommands maps the command lines run by the collectors to their
+// captured output in fixtures/commands.
+var fixtureCommands = map[string]string{
+	"lsid ":              "lsid.txt",
+	"bhosts -w -X":       "bhosts.txt",
+	"bjgroup -s":         "bjgroup_s.txt",
+	"bjgroup -N":         "bjgroup_N.txt",
+	"bqueues -w":         "bqueues.txt",
+	"bqueues -r -l":      "bqueues_rl.txt",
+	"bhpart -r":          "bhpart_r.txt",
+	"busers -w all":      "busers.txt",
+	"bugroup -w":         "bugroup.txt",
+	"lsload -w":          "lsload.txt",
+	"bjobs -A -w -u all": "bjobs_arrays.txt",
+
+	"bjobs -u all -p -o JOBID QUEUE PEND_REASON -json":                                     "bjobs_pending.json",
+	"bjobs -u all -d -o JOBID JOBINDEX STAT QUEUE APPLICATION EXIT_CODE EXIT_REASON -json": "bjobs_exited.json",
+	"bjobs -u all -d -o JOBID JOBINDEX JOB_NAME STAT -json":                                "bjobs_finished.json",
+
+	"lshosts -o HOST_NAME type model cpuf ncpus maxmem maxswp  server nprocs ncores nthreads RESOURCES": "lshosts.txt",
+
+	"bjobs -X -u all -o JOBID JOBINDEX USER STAT QUEUE FROM_HOST EXEC_HOST JOB_NAME SUBMIT_TIME UGROUP PROJECT APPLICATION JOB_GROUP DEPENDENCY NALLOC_SLOT MIN_REQ_PROC START_TIME SUB_CWD PEND_TIME EPENDTIME IPENDTIME SRCJOBID DSTJOBID SRCLUSTER FWD_CLUSTER MEM MAX_MEM AVG_MEM SWAP CPU_USED RUN_TIME MEMLIMIT RUNTIMELIMIT EFFECTIVE_RESREQ -json": "bjobs.json",
+}
+
+// primingCommands maps the collectors that count the changes between two
+// updates to the fixtures of the update run before the golden comparison.
+var primingCommands = map[string]map[string]string{
+	"exited_jobs": {
+		"bjobs -u all -d -o JOBID JOBINDEX STAT QUEUE APPLICATION EXIT_CODE EXIT_REASON -json": "bjobs_exited_before.json",
+	},
+}
+
+// updater exposes a Collector as an unchecked prometheus.Collector.
+type updater struct {
+	collector Collector
+	t         *testing.T
+}
+
+func (u updater) Describe(ch chan<- *prometheus.Desc) {}
+
+func (u updater) Collect(ch chan<- prometheus.Metric) {
+	if err := u.collector.Update(context.Background(), ch); err != nil {
+		u.t.Errorf("Update failed: %v", err)
+	}
+}
+
+func newFixtureConfig() *config.Configuration {
+	return &config.Configuration{
+		CliOpts: config.CliOpts{
+			LsfStdSolverConfig: filepath.Join("fixtures", "solver.csv"),
+		},
+		Runner: &FixtureRunner{
+			Dir:      filepath.Join("fixtures", "commands"),
+			Commands: fixtureCommands,
+		},
+		Accounting: config.LogFile{
+			File:          filepath.Join("fixtures", "logdir", "lsb.acct"),
+			FromBeginning: true,
+		},
+		Events: config.Events{
+			LogFile: config.LogFile{
+				File:          filepath.Join("fixtures", "logdir", "lsb.events"),
+				FromBeginning: true,
+			},
+		},
+	}
+}
+
+// newFixtureConfigWithout returns the fixture configuration without the
+// fixture of a command line, which then fails.
+func newFixtureConfigWithout(line string) *config.Configuration {
+	commands := map[string]string{}
+	for l, file := range fixtureCommands {
+		if l != line {
+			commands[l] = file
+		}
+	}
+	cfg := newFixtureConfig()
+	cfg.Runner = &FixtureRunner{Dir: filepath.Join("fixtures", "commands"), Commands: commands}
+	return cfg
+}
+
+func TestCollectorsGolden(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			cfg := newFixtureConfig()
+			runner := cfg.Runner.(*FixtureRunner)
+			priming, primed := primingCommands[name]
+			if primed {
+				runner.Commands = priming
+			}
+			c, err := factories[name](logger, cfg)
+			if err != nil {
+				t.Fatalf("creating collector: %v", err)
+			}
+			if primed {
+				if _, err := updateMetrics(context.Background(), c); err != nil {
+					t.Fatalf("priming collector: %v", err)
+				}
+				runner.Commands = fixtureCommands
+			}
+			compareGolden(t, c, name)
+		})
+	}
+}
+
+// TestCollectorVariantsGolden covers collector options not enabled by
+// default, each against its own golden file.
+func TestCollectorVariantsGolden(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	perJob := false
+
+	variants := []struct {
+		name      string
+		collector string
+		configure func(cfg *config.Configuration)
+	}{
+		{
+			name:      "lsfjob_aggregated",
+			collector: "lsfjob",
+			configure: func(cfg *config.Configuration) {
+				cfg.Jobs = config.Jobs{PerJob: &perJob, Aggregate: true, AggregateBy: []string{"queue", "status", "solver"}}
+			},
+		},
+		{
+			name:      "lsfjob_labels",
+			collector: "lsfjob",
+			configure: func(cfg *config.Configuration) {
+				cfg.Jobs = config.Jobs{Labels: []string{"JOBID", "USER", "QUEUE", "SOLVER"}}
+			},
+		},
+		{
+			name:      "pending_reason_limit",
+			collector: "pending_reason",
+			configure: func(cfg *config.Configuration) {
+				cfg.Jobs = config.Jobs{PendingReasonsLimit: 2}
+			},
+		},
+		{
+			name:      "lsfjob_pending_buckets",
+			collector: "lsfjob",
+			configure: func(cfg *config.Configuration) {
+				cfg.Jobs = config.Jobs{PerJob: &perJob, PendingTimeBuckets: []time.Duration{30 * time.Minute, time.Hour}}
+			},
+		},
+		{
+			name:      "lsfjob_collapse_arrays",
+			collector: "lsfjob",
+			configure: func(cfg *config.Configuration) {
+				cfg.Jobs = config.Jobs{Labels: []string{"JOBID", "JOB_NAME"}, CollapseArrays: true}
+			},
+		},
+		{
+			name:      "events_stream",
+			collector: "events",
+			configure: func(cfg *config.Configuration) {
+				cfg.Events.File = filepath.Join("fixtures", "logdir", "stream", "lsb.stream")
+				cfg.Events.Stream = true
+			},
+		},
+	}
+
+	for _, v := range variants {
+		v := v
+		t.Run(v.name, func(t *testing.T) {
+			cfg := newFixtureConfig()
+			v.configure(cfg)
+			c, err := factories[v.collector](logger, cfg)
+			if err != nil {
+				t.Fatalf("creating collector: %v", err)
+			}
+			compareGolden(t, c, v.name)
+		})
+	}
+}
+
+// compareGolden compares the metrics of c with fixtures/golden/<name>.prom.
+func compareGolden(t *testing.T, c Collector, name string) {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(updater{collector: c, t: t})
+
+	golden := filepath.Join("fixtures", "golden", name+".prom")
+	if *updateGolden {
+		writeGolden(t, reg, golden)
+	}
+
+	f, err := os.Open(golden)
+	if err != nil {
+		t.Fatalf("opening golden file: %v", err)
+	}
+	defer f.Close()
+	if err := testutil.GatherAndCompare(reg, f); err != nil {
+		t.Error(err)
+	}
+}
+
+func writeGolden(t *testing.T, g prometheus.Gatherer, path string) {
+	t.Helper()
+	mfs, err := g.Gather()
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("creating golden file: %v", err)
+	}
+	defer f.Close()
+	enc := expfmt.NewEncoder(f, expfmt.FmtText)
+	for _, mf := range mfs {
+		if err := enc.Encode(mf); err != nil {
+			t.Fatalf("writing golden file: %v", err)
+		}
+	}
+}
+
+func TestApplyConfigStartsFromFlags(t *testing.T) {
+	defer ApplyConfig(&config.Configuration{})
+
+	timeout := 5 * time.Second
+	enabled := !collectorStates()["lshosts"]
+	before := collectorTimeout("lsfjob")
+	err := ApplyConfig(&config.Configuration{
+		Collectors: map[string]config.Collector{
+			"lsfjob":  {Timeout: &timeout},
+			"lshosts": {Enabled: &enabled},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := collectorTimeout("lsfjob"); got != timeout {
+		t.Errorf("expected the lsfjob timeout from the configuration, got %s", got)
+	}
+	if got := collectorStates()["lshosts"]; got != enabled {
+		t.Errorf("expected lshosts enabled=%v, got %v", enabled, got)
+	}
+
+	if err := ApplyConfig(&config.Configuration{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := collectorTimeout("lsfjob"); got != before {
+		t.Errorf("expected the lsfjob timeout to be restored to %s, got %s", before, got)
+	}
+	if got := collectorStates()["lshosts"]; got == enabled {
+		t.Errorf("expected lshosts enabled=%v to be restored", !enabled)
+	}
+
+	if err := ApplyConfig(&config.Configuration{Collectors: map[string]config.Collector{"nope": {}}}); err == nil {
+		t.Error("expected an error for an unknown collector")
+	}
+	if err := ApplyConfig(&config.Configuration{Jobs: config.Jobs{AggregateBy: []string{"queue", "SUB_CWD"}}}); err == nil {
+		t.Error("expected an error for an unknown aggregation label")
+	}
+	for _, labels := range [][]string{{"JOBID", "SubCWD"}, {"JOBID", "USER", "USER"}, {"USER", "QUEUE"}} {
+		if err := ApplyConfig(&config.Configuration{Jobs: config.Jobs{Labels: labels}}); err == nil {
+			t.Errorf("expected an error for jobs.labels %v", labels)
+		}
+	}
+}
+
+func TestResetCollectorsKeepsState(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	records, err := os.ReadFile(filepath.Join("fixtures", "logdir", "lsb.acct"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := records[:bytes.IndexByte(records, '\n')+1]
+	acct := filepath.Join(t.TempDir(), "lsb.acct")
+	if err := os.WriteFile(acct, records, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	appendRecord := func() {
+		f, err := os.OpenFile(acct, os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	enabled := true
+	cfg := newFixtureConfig()
+	cfg.Accounting = config.LogFile{File: acct}
+	cfg.Collectors = map[string]config.Collector{"acct": {Enabled: &enabled}}
+	if err := ApplyConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ApplyConfig(&config.Configuration{})
+		ResetCollectors()
+	}()
+
+	// finished returns the number of finished jobs counted so far.
+	finished := func() float64 {
+		t.Helper()
+		nc, err := NewLsfCollector(logger, cfg, "acct")
+		if err != nil {
+			t.Fatal(err)
+		}
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(updater{collector: nc.Collectors["acct"], t: t})
+		mfs, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0.0
+		for _, mf := range mfs {
+			if mf.GetName() == "lsf_acct_finished_jobs_total" {
+				for _, m := range mf.GetMetric() {
+					n += m.GetCounter().GetValue()
+				}
+			}
+		}
+		return n
+	}
+
+	// The file is read from its end, so only the appended records count.
+	if n := finished(); n != 0 {
+		t.Fatalf("expected no finished job before the first record, got %v", n)
+	}
+	appendRecord()
+	if n := finished(); n != 1 {
+		t.Fatalf("expected 1 finished job, got %v", n)
+	}
+	ResetCollectors()
+	appendRecord()
+	if n := finished(); n != 2 {
+		t.Errorf("expected the total and the offset to survive a reload, got %v finished jobs; want 2", n)
+	}
+}
@@ -0,0 +1,397 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// depState is the state of a dependency condition.
+type depState int
+
+const (
+	// depWaiting conditions may still be satisfied.
+	depWaiting depState = iota
+	depSatisfied
+	// depNever conditions can never be satisfied, such as done() of a job
+	// that exited.
+	depNever
+)
+
+// depNode is a node of a parsed DEPENDENCY expression: an operator (&&, ||
+// or !) over its children, or a condition such as done(123).
+type depNode struct {
+	op       string
+	children []*depNode
+	// cond is the condition, in lower case, and job its job ID or name.
+	cond string
+	job  string
+}
+
+// depJobIDRegex matches job IDs, with an optional array index, as opposed
+// to job names.
+var depJobIDRegex = regexp.MustCompile(`^\d+(\[\d+\])?$`)
+
+// parseDependency parses a DEPENDENCY expression of bjobs, as written with
+// bsub -w, such as "done(123) && (ended(456) || !exit(789))". A bare job ID
+// or name stands for done().
+func parseDependency(expr string) (*depNode, error) {
+	p := &depParser{s: expr}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.s) {
+		return nil, fmt.Errorf("unexpected %q at %d", p.s[p.pos:], p.pos)
+	}
+	return n, nil
+}
+
+type depParser struct {
+	s   string
+	pos int
+}
+
+func (p *depParser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// accept consumes tok if it comes next.
+func (p *depParser) accept(tok string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.s[p.pos:], tok) {
+		p.pos += len(tok)
+		return true
+	}
+	return false
+}
+
+func (p *depParser) parseOr() (*depNode, error) {
+	return p.parseBinary("||", p.parseAnd)
+}
+
+func (p *depParser) parseAnd() (*depNode, error) {
+	return p.parseBinary("&&", p.parseUnary)
+}
+
+func (p *depParser) parseBinary(op string, operand func() (*depNode, error)) (*depNode, error) {
+	n, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(op) {
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if n.op == op {
+			n.children = append(n.children, right)
+		} else {
+			n = &depNode{op: op, children: []*depNode{n, right}}
+		}
+	}
+	return n, nil
+}
+
+func (p *depParser) parseUnary() (*depNode, error) {
+	if p.accept("!") {
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &depNode{op: "!", children: []*depNode{n}}, nil
+	}
+	if p.accept("(") {
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, errors.New("missing )")
+		}
+		return n, nil
+	}
+	return p.parseCondition()
+}
+
+// parseCondition parses cond(job[, args]) or a bare job.
+func (p *depParser) parseCondition() (*depNode, error) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune(" \t()&|!", rune(p.s[p.pos])) {
+		p.pos++
+	}
+	word := p.s[start:p.pos]
+	if word == "" {
+		return nil, fmt.Errorf("expected a condition at %d", start)
+	}
+	if !p.accept("(") {
+		return &depNode{cond: "done", job: unquoteDepJob(word)}, nil
+	}
+
+	argStart := p.pos
+	for p.pos < len(p.s) && p.s[p.pos] != ')' {
+		p.pos++
+	}
+	if p.pos == len(p.s) {
+		return nil, fmt.Errorf("missing ) after %s", word)
+	}
+	args := p.s[argStart:p.pos]
+	p.pos++
+	job, _, _ := strings.Cut(args, ",")
+	return &depNode{cond: strings.ToLower(word), job: unquoteDepJob(job)}, nil
+}
+
+func unquoteDepJob(job string) string {
+	return strings.Trim(strings.TrimSpace(job), `"'`)
+}
+
+// jobs returns the job IDs and names the expression refers to.
+func (n *depNode) jobs() []string {
+	if n.op == "" {
+		return []string{n.job}
+	}
+	jobs := []string{}
+	for _, c := range n.children {
+		jobs = append(jobs, c.jobs()...)
+	}
+	return jobs
+}
+
+// eval returns the state of the expression, given the states of the jobs
+// it refers to. Jobs that are not known leave their conditions waiting.
+func (n *depNode) eval(states map[string][]string) depState {
+	switch n.op {
+	case "!":
+		switch n.children[0].eval(states) {
+		case depSatisfied:
+			return depNever
+		case depNever:
+			return depSatisfied
+		}
+		return depWaiting
+	case "&&", "||":
+		// The state an operand decides the operator with.
+		decisive := depNever
+		if n.op == "||" {
+			decisive = depSatisfied
+		}
+		result := depSatisfied
+		if n.op == "||" {
+			result = depNever
+		}
+		for _, c := range n.children {
+			s := c.eval(states)
+			if s == decisive {
+				return s
+			}
+			if s == depWaiting {
+				result = depWaiting
+			}
+		}
+		return result
+	}
+
+	jobStates, ok := states[n.job]
+	if !ok {
+		return depWaiting
+	}
+	result := depSatisfied
+	for _, s := range jobStates {
+		switch condState(n.cond, s) {
+		case depNever:
+			return depNever
+		case depWaiting:
+			result = depWaiting
+		}
+	}
+	return result
+}
+
+// condState returns the state of a condition over a job in the given STAT.
+func condState(cond, stat string) depState {
+	finished := stat == "DONE" || stat == "EXIT"
+	switch cond {
+	case "done", "post_done":
+		if stat == "DONE" {
+			return depSatisfied
+		} else if stat == "EXIT" {
+			return depNever
+		}
+	case "exit", "post_err":
+		if stat == "EXIT" {
+			return depSatisfied
+		} else if stat == "DONE" {
+			return depNever
+		}
+	case "ended":
+		if finished {
+			return depSatisfied
+		}
+	case "started":
+		if finished || stat == "RUN" || stat == "SSUSP" || stat == "USUSP" {
+			return depSatisfied
+		}
+	}
+	return depWaiting
+}
+
+// addJobState records the STAT of a job under its ID, the ID of its array
+// and its name, the keys dependency conditions refer to it by.
+func addJobState(states map[string][]string, id, arrayID, arrayIndex, name, stat string) {
+	states[id] = append(states[id], stat)
+	if arrayID != "" {
+		if arrayID != id {
+			states[arrayID] = append(states[arrayID], stat)
+		}
+		states[arrayID+"["+arrayIndex+"]"] = append(states[arrayID+"["+arrayIndex+"]"], stat)
+	}
+	if name != "" && !depJobIDRegex.MatchString(name) {
+		states[name] = append(states[name], stat)
+	}
+}
+
+// dependencyStates returns the STAT of the unfinished jobs and of the jobs
+// finished recently, read with bjobs -d, by the keys dependency conditions
+// refer to them by.
+func (c *JobCollector) dependencyStates(ctx context.Context, jobs []Job) (map[string][]string, error) {
+	states := map[string][]string{}
+	for i := range jobs {
+		j := &jobs[i]
+		addJobState(states, j.ID, j.ArrayID, j.ArrayIndex, j.JobName, j.Status)
+	}
+
+	output, err := c.runner.Run(ctx, "bjobs", "-u", "all", "-d", "-o", "JOBID JOBINDEX JOB_NAME STAT", "-json")
+	if isErrorKind(err, ErrorKindNoJobs) {
+		return states, nil
+	} else if err != nil {
+		return nil, err
+	}
+	finished, err := bjobs_JsontoStruct(output, c.logger)
+	if err != nil {
+		return nil, newParseError("lsfjob", "bjobs", err)
+	}
+	for _, f := range finished {
+		arrayID, arrayIndex := "", ""
+		if f.JOBINDEX != "" && f.JOBINDEX != "0" {
+			arrayID, arrayIndex = f.JOBID, f.JOBINDEX
+		}
+		addJobState(states, f.JOBID, arrayID, arrayIndex, f.JOB_NAME, f.STATUS)
+	}
+	return states, nil
+}
+
+// dependencyDepths returns the depth of each job, the number of unfinished
+// jobs it waits for in a row.
+func dependencyDepths(jobs []Job, exprs map[int]*depNode) []int {
+	byKey := map[string][]int{}
+	for i := range jobs {
+		j := &jobs[i]
+		keys := []string{j.ID}
+		if j.ArrayID != "" && j.ArrayID != j.ID {
+			keys = append(keys, j.ArrayID)
+		}
+		if j.JobName != "" && !depJobIDRegex.MatchString(j.JobName) {
+			keys = append(keys, j.JobName)
+		}
+		for _, k := range keys {
+			byKey[k] = append(byKey[k], i)
+		}
+	}
+
+	depths := make([]int, len(jobs))
+	done := make([]bool, len(jobs))
+	visiting := make([]bool, len(jobs))
+	var depth func(i int) int
+	depth = func(i int) int {
+		if done[i] || visiting[i] {
+			// A cycle is cut where it is found.
+			return depths[i]
+		}
+		visiting[i] = true
+		if n, ok := exprs[i]; ok {
+			for _, ref := range n.jobs() {
+				for _, p := range byKey[ref] {
+					if d := depth(p) + 1; p != i && d > depths[i] {
+						depths[i] = d
+					}
+				}
+			}
+		}
+		visiting[i] = false
+		done[i] = true
+		return depths[i]
+	}
+	for i := range jobs {
+		depth(i)
+	}
+	return depths
+}
+
+// collectDependencies sends the number of pending jobs whose dependency is
+// not satisfied yet or can never be, and the depth of the dependency chains
+// of each job group. bjobs -d is only run when some job has a dependency.
+// When it fails, the error is logged, the runner having counted it, and only
+// the depths are sent, so that the other job metrics are still exported.
+func (c *JobCollector) collectDependencies(ctx context.Context, ch chan<- prometheus.Metric, jobs []Job) {
+	exprs := map[int]*depNode{}
+	for i := range jobs {
+		j := &jobs[i]
+		if strings.TrimSpace(j.Dependency) == "" {
+			continue
+		}
+		n, err := parseDependency(j.Dependency)
+		if err != nil {
+			c.logger.Debug("Couldn't parse job dependency", "job", j.ID, "dependency", j.Dependency, "err", err)
+			continue
+		}
+		exprs[i] = n
+	}
+
+	type key struct{ queue, jobGroup string }
+	blocked := map[key]float64{}
+	never := map[key]float64{}
+	if len(exprs) > 0 {
+		if states, err := c.dependencyStates(ctx, jobs); err != nil {
+			c.logger.Warn("Couldn't get the states of the finished jobs, skipping job dependency states", "err", err)
+		} else {
+			for i, n := range exprs {
+				j := &jobs[i]
+				if j.Status != "PEND" && j.Status != "PSUSP" {
+					continue
+				}
+				switch n.eval(states) {
+				case depWaiting:
+					blocked[key{j.Queue, j.JGroup}]++
+				case depNever:
+					never[key{j.Queue, j.JGroup}]++
+				}
+			}
+		}
+	}
+
+	depths := map[string]float64{}
+	for i, d := range dependencyDepths(jobs, exprs) {
+		g := jobs[i].JGroup
+		if v, ok := depths[g]; !ok || float64(d) > v {
+			depths[g] = float64(d)
+		}
+	}
+
+	for k, n := range blocked {
+		ch <- prometheus.MustNewConstMetric(c.DependencyBlocked, prometheus.GaugeValue, n, k.queue, k.jobGroup)
+	}
+	for k, n := range never {
+		ch <- prometheus.MustNewConstMetric(c.DependencyNever, prometheus.GaugeValue, n, k.queue, k.jobGroup)
+	}
+	for g, d := range depths {
+		ch <- prometheus.MustNewConstMetric(c.DependencyDepth, prometheus.GaugeValue, d, g)
+	}
+}
@@ -0,0 +1,117 @@
+package collector
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseDependency(t *testing.T) {
+	states := map[string][]string{
+		"1":       {"DONE"},
+		"2":       {"EXIT"},
+		"3":       {"RUN"},
+		"4":       {"PEND"},
+		"array":   {"DONE", "RUN"},
+		"5[2]":    {"DONE"},
+		"nightly": {"EXIT"},
+	}
+	for _, tc := range []struct {
+		expr string
+		want depState
+		jobs []string
+	}{
+		{"done(1)", depSatisfied, []string{"1"}},
+		{"done(2)", depNever, []string{"2"}},
+		{"exit(2, > 1)", depSatisfied, []string{"2"}},
+		{"ended(3)", depWaiting, []string{"3"}},
+		{"started(3) && !exit(1)", depSatisfied, []string{"3", "1"}},
+		{"done(1) && ended(4)", depWaiting, []string{"1", "4"}},
+		{"done(2) && ended(4)", depNever, []string{"2", "4"}},
+		{"done(2) || (ended(4) || done(1))", depSatisfied, []string{"2", "4", "1"}},
+		{`done("nightly") || exit(1)`, depNever, []string{"nightly", "1"}},
+		{"done(array)", depWaiting, []string{"array"}},
+		{"5[2] && post_done(999)", depWaiting, []string{"5[2]", "999"}},
+		{"numdone(1, >= 5)", depWaiting, []string{"1"}},
+	} {
+		n, err := parseDependency(tc.expr)
+		if err != nil {
+			t.Errorf("parseDependency(%q): %v", tc.expr, err)
+			continue
+		}
+		if got := n.eval(states); got != tc.want {
+			t.Errorf("parseDependency(%q).eval() = %v; want %v", tc.expr, got, tc.want)
+		}
+		if got := n.jobs(); !reflect.DeepEqual(got, tc.jobs) {
+			t.Errorf("parseDependency(%q).jobs() = %q; want %q", tc.expr, got, tc.jobs)
+		}
+	}
+
+	for _, expr := range []string{"done(1", "(done(1)", "done(1) &&", "done(1) done(2)"} {
+		if _, err := parseDependency(expr); err == nil {
+			t.Errorf("parseDependency(%q) should fail", expr)
+		}
+	}
+}
+
+func TestDependencyDepths(t *testing.T) {
+	jobs := []Job{
+		{ID: "1", JobName: "mesh"},
+		{ID: "2", Dependency: "done(mesh)"},
+		{ID: "3", Dependency: "done(2) && done(1)"},
+		{ID: "4", Dependency: "done(5)"},
+		{ID: "5", Dependency: "done(4)"},
+	}
+	exprs := map[int]*depNode{}
+	for i, j := range jobs {
+		if j.Dependency != "" {
+			n, err := parseDependency(j.Dependency)
+			if err != nil {
+				t.Fatal(err)
+			}
+			exprs[i] = n
+		}
+	}
+	got := dependencyDepths(jobs, exprs)
+	if got[0] != 0 || got[1] != 1 || got[2] != 2 {
+		t.Errorf("dependencyDepths() = %v; want 0, 1, 2 for the chain", got)
+	}
+	if got[3] > 2 || got[4] > 2 {
+		t.Errorf("dependencyDepths() = %v; the cycle should be cut", got)
+	}
+}
+
+func TestDependencyStatesFailureKeepsJobMetrics(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	// Without a fixture, bjobs -d fails.
+	cfg := newFixtureConfigWithout("bjobs -u all -d -o JOBID JOBINDEX JOB_NAME STAT -json")
+	c, err := NewLSFJobCollector(logger, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, err := updateMetrics(context.Background(), c)
+	if err != nil {
+		t.Fatalf("expected the job metrics despite the failure of bjobs -d, got %v", err)
+	}
+	if len(metrics) == 0 {
+		t.Error("expected job metrics, got none")
+	}
+	expected := `
+# HELP lsf_jobs_dependency_chain_depth Longest chain of unfinished jobs waiting for one another in the job group.
+# TYPE lsf_jobs_dependency_chain_depth gauge
+lsf_jobs_dependency_chain_depth{job_group=""} 2
+lsf_jobs_dependency_chain_depth{job_group="/aero/sweep"} 0
+lsf_jobs_dependency_chain_depth{job_group="/aero/wing"} 0
+`
+	err = testutil.CollectAndCompare(updater{collector: c, t: t}, strings.NewReader(expected),
+		"lsf_jobs_dependency_blocked", "lsf_jobs_dependency_chain_depth", "lsf_jobs_dependency_unsatisfiable")
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,375 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"lsf_exporter/config"
+)
+
+// LSF job states of the jStatus field of lsb.events records, besides
+// lsbJobStatusExit and lsbJobStatusDone.
+const (
+	lsbJobStatusPend = 0x01
+)
+
+// hostCtrlActions names the opCode of HOST_CTRL records.
+var hostCtrlActions = map[int64]string{
+	1: "open",
+	2: "close",
+	3: "reboot",
+	4: "shutdown",
+}
+
+// Jobs without events for eventsFinishedRetention, once all their known
+// elements finished, or for eventsRetention otherwise, are forgotten, in
+// seconds of event time. mbatchd copies the records of the unfinished jobs
+// to the new lsb.events when it switches files, which keeps them known.
+const (
+	eventsFinishedRetention = 24 * 60 * 60
+	eventsRetention         = 30 * 24 * 60 * 60
+)
+
+// eventJob holds what the events collector knows about a job and its array
+// elements.
+type eventJob struct {
+	// key holds the queue, user and project of the job, read from its
+	// JOB_NEW or JOB_FINISH record when known is set.
+	key   eventKey
+	known bool
+	// elements holds the state of the job, at index 0, or of the elements of
+	// the job array.
+	elements map[int64]*eventElement
+	// lastEvent is the time of the last record of the job.
+	lastEvent int64
+}
+
+// eventElement holds the state of a job, or an element of a job array.
+type eventElement struct {
+	started, finished bool
+}
+
+type eventKey struct {
+	queue, user, project string
+}
+
+type eventTotals struct {
+	submitted, started, done, exited, requeued float64
+}
+
+type eventsCollector struct {
+	Jobs         *prometheus.Desc
+	HostControls *prometheus.Desc
+	logger       *slog.Logger
+	config       *config.Configuration
+	*eventsState
+}
+
+// eventsState is the state of the events collector, handed over on reload.
+type eventsState struct {
+	mtx    sync.Mutex
+	tailer *logTailer
+	// jobs holds the jobs seen since the file was first read, by job ID.
+	jobs map[int64]*eventJob
+	// eventTime is the time of the latest record read.
+	eventTime    int64
+	totals       map[eventKey]*eventTotals
+	hostControls map[string]float64
+}
+
+func init() {
+	registerCollector("events", defaultDisabled, NewEventsCollector)
+}
+
+// NewEventsCollector returns a new Collector counting the job and host
+// events read from lsb.events or lsb.stream.
+func NewEventsCollector(logger *slog.Logger, config *config.Configuration) (Collector, error) {
+	return &eventsCollector{
+		Jobs: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "events", "jobs_total"),
+			"Number of job events read from the mbatchd event log, by event (submitted, started, done, exited, requeued).",
+			[]string{"queue", "user", "project", "event"}, nil,
+		),
+		HostControls: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "events", "host_controls_total"),
+			"Number of badmin host control operations read from the mbatchd event log.",
+			[]string{"action"}, nil,
+		),
+		logger: logger,
+		config: config,
+		eventsState: &eventsState{
+			jobs:         map[int64]*eventJob{},
+			totals:       map[eventKey]*eventTotals{},
+			hostControls: map[string]float64{},
+		},
+	}, nil
+}
+
+// inherit implements stateInheritor. The totals and the jobs are kept, and
+// so is the offset in the event log unless the reload changed the file to
+// read.
+func (c *eventsCollector) inherit(prev Collector) {
+	p, ok := prev.(*eventsCollector)
+	if !ok {
+		return
+	}
+	c.eventsState = p.eventsState
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if p.config.Events.Stream != c.config.Events.Stream ||
+		!sameLogFile(p.config, c.config, p.config.Events.LogFile, c.config.Events.LogFile) {
+		c.tailer = nil
+	}
+}
+
+// Update reads the events appended since the last call and exports the
+// totals.
+func (c *eventsCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	err := c.readEvents(ctx)
+	c.collectTotals(ch)
+	if err != nil {
+		return fmt.Errorf("couldn't read the event log: %w", err)
+	}
+	return nil
+}
+
+func (c *eventsCollector) readEvents(ctx context.Context) error {
+	if c.tailer == nil {
+		name := "lsb.events"
+		if c.config.Events.Stream {
+			name = "stream/lsb.stream"
+		}
+		tailer, err := newLogTailer(c.logger, c.config, c.config.Events.LogFile, name)
+		if err != nil {
+			return err
+		}
+		c.tailer = tailer
+	}
+
+	defer c.expireJobs()
+	return c.tailer.read(ctx, func(line string) {
+		// The header of lsb.events starts with #.
+		if !strings.HasPrefix(line, `"`) {
+			return
+		}
+		fields, err := splitLSBRecord(line)
+		if err == nil {
+			err = c.handleEvent(fields)
+		}
+		if err != nil {
+			c.logger.Warn("Couldn't parse event record", "err", err)
+			parseErrorsTotal.WithLabelValues("events").Inc()
+		}
+	})
+}
+
+// handleEvent updates the totals with an event record, as documented in
+// lsb.events(5).
+func (c *eventsCollector) handleEvent(fields []string) error {
+	f := &lsbFields{fields: fields}
+	f.skip(2) // event type, version
+	t := f.int()
+	if t > c.eventTime {
+		c.eventTime = t
+	}
+	switch fields[0] {
+	case "JOB_NEW":
+		id := f.int()
+		f.skip(9) // userId ... restartPid
+		user := f.str()
+		f.skip(14) // rLimits, hostSpec, hostFactor, umask
+		queue := f.str()
+		f.skip(12)   // resReq ... jobFile
+		f.skipList() // askedHosts
+		f.skip(4)    // dependCond, timeEvent, jobName, command
+		f.skip(3 * int(f.int()))
+		f.skip(1) // mailUser
+		project := f.str()
+		if f.err != nil {
+			return f.err
+		}
+		c.submitted(c.job(id, t), eventKey{queue, user, project})
+
+	case "JOB_START":
+		id := f.int()
+		f.skip(4)    // jStatus, jobPid, jobPGid, hostFactor
+		f.skipList() // execHosts
+		f.skip(4)    // queuePreCmd, queuePostCmd, jFlags, userGroup
+		index := f.int()
+		if f.err != nil {
+			return f.err
+		}
+		j := c.job(id, t)
+		if e := j.element(index); !e.started {
+			e.started, e.finished = true, false
+			c.totalsOf(j).started++
+		}
+
+	case "JOB_STATUS":
+		id := f.int()
+		status := f.int()
+		f.skip(4) // reason, subreasons, cpuTime, endTime
+		if ru := f.int(); ru != 0 {
+			f.skip(19) // lsfRusage
+		}
+		f.skip(2) // jFlags, exitStatus
+		index := f.int()
+		if f.err != nil {
+			return f.err
+		}
+		if c.config.Events.Stream && status&(lsbJobStatusDone|lsbJobStatusExit) != 0 {
+			// lsb.stream also holds the JOB_FINISH record of the job.
+			return nil
+		}
+		c.statusChanged(c.job(id, t), index, status)
+
+	case "JOB_FINISH":
+		r, err := parseJobFinish(fields)
+		if err != nil {
+			return err
+		}
+		j := c.job(r.JobID, t)
+		if !j.known {
+			j.key, j.known = eventKey{r.Queue, r.User, r.Project}, true
+		}
+		c.statusChanged(j, r.Index, r.Status)
+
+	case "JOB_CLEAN":
+		id := f.int()
+		index := f.int()
+		if f.err != nil {
+			return f.err
+		}
+		// The job stays known while the other elements of an array run.
+		if j, ok := c.jobs[id]; ok {
+			delete(j.elements, index)
+			if index == 0 {
+				delete(c.jobs, id)
+			}
+		}
+
+	case "HOST_CTRL":
+		op := f.int()
+		if f.err != nil {
+			return f.err
+		}
+		action, ok := hostCtrlActions[op]
+		if !ok {
+			action = strconv.FormatInt(op, 10)
+		}
+		c.hostControls[action]++
+	}
+	return nil
+}
+
+// submitted records the submission of a job. mbatchd copies the JOB_NEW
+// records of the unfinished jobs to the new lsb.events when it switches
+// files, so a job already known is not counted again.
+func (c *eventsCollector) submitted(j *eventJob, k eventKey) {
+	if j.known {
+		return
+	}
+	j.key, j.known = k, true
+	c.totalsOf(j).submitted++
+}
+
+// statusChanged counts a job reaching DONE or EXIT, or going back to PEND
+// after it started.
+func (c *eventsCollector) statusChanged(j *eventJob, index, status int64) {
+	e := j.element(index)
+	switch {
+	case status&lsbJobStatusDone != 0 && !e.finished:
+		e.finished = true
+		c.totalsOf(j).done++
+	case status&lsbJobStatusExit != 0 && !e.finished:
+		e.finished = true
+		c.totalsOf(j).exited++
+	case status&lsbJobStatusPend != 0 && e.started:
+		e.started, e.finished = false, false
+		c.totalsOf(j).requeued++
+	}
+}
+
+// job returns the job of an ID, recording t as the time of its last event.
+func (c *eventsCollector) job(id, t int64) *eventJob {
+	j := c.jobs[id]
+	if j == nil {
+		j = &eventJob{elements: map[int64]*eventElement{}}
+		c.jobs[id] = j
+	}
+	if t > j.lastEvent {
+		j.lastEvent = t
+	}
+	return j
+}
+
+func (j *eventJob) element(index int64) *eventElement {
+	e := j.elements[index]
+	if e == nil {
+		e = &eventElement{}
+		j.elements[index] = e
+	}
+	return e
+}
+
+// finished tells whether all the known elements of the job finished.
+func (j *eventJob) finished() bool {
+	for _, e := range j.elements {
+		if !e.finished {
+			return false
+		}
+	}
+	return true
+}
+
+// expireJobs forgets the jobs without events for eventsFinishedRetention
+// or eventsRetention, so that the jobs whose JOB_CLEAN record is never read,
+// as in lsb.stream, don't pile up.
+func (c *eventsCollector) expireJobs() {
+	for id, j := range c.jobs {
+		retention := int64(eventsRetention)
+		if j.finished() {
+			retention = eventsFinishedRetention
+		}
+		if c.eventTime-j.lastEvent > retention {
+			delete(c.jobs, id)
+		}
+	}
+}
+
+// totalsOf returns the totals of the queue, user and project of a job. The
+// labels of the jobs submitted before the file was first read are empty.
+func (c *eventsCollector) totalsOf(j *eventJob) *eventTotals {
+	t := c.totals[j.key]
+	if t == nil {
+		t = &eventTotals{}
+		c.totals[j.key] = t
+	}
+	return t
+}
+
+func (c *eventsCollector) collectTotals(ch chan<- prometheus.Metric) {
+	for k, t := range c.totals {
+		for event, v := range map[string]float64{
+			"submitted": t.submitted,
+			"started":   t.started,
+			"done":      t.done,
+			"exited":    t.exited,
+			"requeued":  t.requeued,
+		} {
+			ch <- prometheus.MustNewConstMetric(c.Jobs, prometheus.CounterValue, v, k.queue, k.user, k.project, event)
+		}
+	}
+	for action, v := range c.hostControls {
+		ch <- prometheus.MustNewConstMetric(c.HostControls, prometheus.CounterValue, v, action)
+	}
+}
@@ -0,0 +1,68 @@
+package collector
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestEventsForgetsJobs(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	collector, err := NewEventsCollector(logger, newFixtureConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := collector.(*eventsCollector)
+	handle := func(lines ...string) {
+		t.Helper()
+		for _, line := range lines {
+			fields, err := splitLSBRecord(line)
+			if err == nil {
+				err = c.handleEvent(fields)
+			}
+			if err != nil {
+				t.Fatalf("couldn't handle %q: %v", line, err)
+			}
+		}
+		c.expireJobs()
+	}
+	hostCtrl := func(at int64) string {
+		return fmt.Sprintf(`"HOST_CTRL" "10.1" %d 1 "node02" "admin" ""`, at)
+	}
+
+	// Job array 3003 runs two elements, and job 3004 starts.
+	handle(
+		`"JOB_NEW" "10.1" 1700000000 3003 1001 33554450 1 1700000000 0 0 0 -1 0 "alice" -1 -1 -1 -1 -1 -1 -1 -1 -1 -1 -1 "" 1.00 18 "normal" "select[type==any]" "login1" "/home/alice" "" "/dev/null" "out.%J" "" "" "" "" "/home/alice" "1700000000.3003" 0 "" 0 "job" "sleep 100" 0 "" "proj_a" 0 1 "" "" "" "" 0 0`,
+		`"JOB_START" "10.1" 1700000100 3003 4 1234 1234 1.00 1 "node01" "" "" 0 "" 1 "" 0 0 ""`,
+		`"JOB_START" "10.1" 1700000100 3003 4 1234 1234 1.00 1 "node01" "" "" 0 "" 2 "" 0 0 ""`,
+		`"JOB_START" "10.1" 1700000100 3004 4 1234 1234 1.00 1 "node01" "" "" 0 "" 0 "" 0 0 ""`,
+		`"JOB_STATUS" "10.1" 1700000200 3003 64 0 0 1.5 1700000200 0 0 0 1 0 0`,
+	)
+	if n := len(c.jobs[3003].elements); n != 2 {
+		t.Fatalf("expected 2 elements of job 3003, got %d", n)
+	}
+
+	// Cleaning an element forgets it, but not the array, whose labels the
+	// other elements need.
+	handle(`"JOB_CLEAN" "10.1" 1700000300 3003 1`)
+	if j := c.jobs[3003]; j == nil || len(j.elements) != 1 || j.key.user != "alice" {
+		t.Fatalf("expected job 3003 to keep its labels and element 2, got %+v", j)
+	}
+
+	// Once its elements finished, the array is forgotten after a day
+	// without events, while the unfinished job 3004 is kept.
+	handle(`"JOB_STATUS" "10.1" 1700000400 3003 64 0 0 1.5 1700000400 0 0 0 2 0 0`)
+	handle(hostCtrl(1700000400 + eventsFinishedRetention + 1))
+	if _, ok := c.jobs[3003]; ok {
+		t.Error("expected the finished job 3003 to be forgotten")
+	}
+	if _, ok := c.jobs[3004]; !ok {
+		t.Error("expected the running job 3004 to be kept")
+	}
+
+	handle(hostCtrl(1700000100 + eventsRetention + 1))
+	if len(c.jobs) != 0 {
+		t.Errorf("expected all the jobs to be forgotten, got %d", len(c.jobs))
+	}
+}
@@ -0,0 +1,214 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"lsf_exporter/config"
+)
+
+// noExitReason is the exit reason of the jobs that exited on their own,
+// with a non-zero exit code.
+const noExitReason = "none"
+
+// termReason describes a TERM_* termination reason of LSF.
+type termReason struct {
+	Name string
+	// Description is the text bjobs shows for the reason.
+	Description string
+}
+
+// termReasons lists the termination reasons, with the description bjobs
+// shows for each.
+// Reference: lsbatch.h of the LSF API.
+var termReasons = []termReason{
+	{"TERM_UNKNOWN", "LSF cannot determine a termination reason"},
+	{"TERM_PREEMPT", "job killed after preemption"},
+	{"TERM_WINDOW", "job killed after queue run window closed"},
+	{"TERM_LOAD", "job killed after load exceeds threshold"},
+	{"TERM_OTHER", "member of a chunk job in WAIT state killed and requeued"},
+	{"TERM_RUNLIMIT", "job killed after reaching LSF run time limit"},
+	{"TERM_DEADLINE", "job killed after deadline expires"},
+	{"TERM_PROCESSLIMIT", "job killed after reaching LSF process limit"},
+	{"TERM_FORCE_OWNER", "job killed by owner without time for cleanup"},
+	{"TERM_FORCE_ADMIN", "job killed by root or LSF administrator without time for cleanup"},
+	{"TERM_REQUEUE_OWNER", "job killed and requeued by owner"},
+	{"TERM_REQUEUE_ADMIN", "job killed and requeued by root or LSF administrator"},
+	{"TERM_CPULIMIT", "job killed after reaching LSF CPU usage limit"},
+	{"TERM_CHKPNT", "job killed after checkpointing"},
+	{"TERM_OWNER", "job killed by owner"},
+	{"TERM_ADMIN", "job killed by root or LSF administrator"},
+	{"TERM_MEMLIMIT", "job killed after reaching LSF memory usage limit"},
+	{"TERM_EXTERNAL_SIGNAL", "job killed by a signal external to LSF"},
+	{"TERM_RMS", "job exited from an RMS system error"},
+	{"TERM_ZOMBIE", "job exited while LSF is not available"},
+	{"TERM_SWAP", "job killed after reaching LSF swap usage limit"},
+	{"TERM_THREADLIMIT", "job killed after reaching LSF thread limit"},
+	{"TERM_SLURM", "job terminated abnormally in SLURM"},
+	{"TERM_BUCKET_KILL", "job killed with bkill -b"},
+	{"TERM_CTRL_PID", "job terminated after control PID died"},
+	{"TERM_CWD_NOTEXIST", "current working directory is not accessible or does not exist on the execution host"},
+	{"TERM_REMOVE_HUNG_JOB", "job removed from LSF after being hung"},
+	{"TERM_ORPHAN_SYSTEM", "orphan job killed after its dependency was not satisfied"},
+	{"TERM_PRE_EXEC_FAIL", "job killed after the pre-execution command failed"},
+	{"TERM_DATA", "job killed after its data requirement could not be satisfied"},
+	{"TERM_MC_RECALL", "job killed after being recalled by the submission cluster"},
+	{"TERM_RC_RECALL", "job killed after being recalled by the resource connector"},
+}
+
+// normalizeExitReason returns the TERM_* name of the EXIT_REASON bjobs
+// shows, such as "TERM_MEMLIMIT: job killed after reaching LSF memory usage
+// limit" or its description alone, noExitReason when it is empty, or
+// "other" when it is not known.
+func normalizeExitReason(reason string) string {
+	reason = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(reason), "."))
+	if reason == "" || reason == "-" {
+		return noExitReason
+	}
+	if strings.HasPrefix(reason, "TERM_") {
+		name, _, _ := strings.Cut(reason, ":")
+		return strings.TrimSpace(name)
+	}
+	for _, r := range termReasons {
+		if strings.EqualFold(reason, r.Description) {
+			return r.Name
+		}
+	}
+	return "other"
+}
+
+type exitedJobsCollector struct {
+	ExitedJobs *prometheus.Desc
+	ExitCodes  *prometheus.Desc
+	logger     *slog.Logger
+	runner     config.CommandRunner
+	solvers    solverMapper
+	*exitedJobsState
+}
+
+// exitedJobsState is the state of the exited_jobs collector, handed over on
+// reload.
+type exitedJobsState struct {
+	mtx sync.Mutex
+	// seen holds the jobs of the last bjobs -d output, so that a job is
+	// counted once while it is listed.
+	seen map[string]bool
+	// primed is set once seen holds the jobs listed when the collector
+	// started, which are not counted.
+	primed    bool
+	exited    map[exitedJobsKey]float64
+	exitCodes map[exitedJobsKey]float64
+}
+
+// exitedJobsKey holds the labels of the exited jobs counters. value is the
+// exit reason or the exit code.
+type exitedJobsKey struct {
+	queue, solver, value string
+}
+
+func init() {
+	registerCollector("exited_jobs", defaultDisabled, NewExitedJobsCollector)
+}
+
+// NewExitedJobsCollector returns a new Collector counting the jobs that
+// exited, by termination reason and exit code.
+func NewExitedJobsCollector(logger *slog.Logger, config *config.Configuration) (Collector, error) {
+	return &exitedJobsCollector{
+		ExitedJobs: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "jobs", "exited_total"),
+			"Number of jobs that exited, by termination reason.",
+			[]string{"queue", "solver", "exit_reason"}, nil,
+		),
+		ExitCodes: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "jobs", "exit_code_total"),
+			"Number of jobs that exited, by exit code.",
+			[]string{"queue", "solver", "exit_code"}, nil,
+		),
+		logger:  logger,
+		runner:  newCommandRunner(logger, config),
+		solvers: newSolverMapper(config),
+		exitedJobsState: &exitedJobsState{
+			seen:      map[string]bool{},
+			exited:    map[exitedJobsKey]float64{},
+			exitCodes: map[exitedJobsKey]float64{},
+		},
+	}, nil
+}
+
+// inherit implements stateInheritor, so that the jobs counted before a
+// reload are not counted again.
+func (c *exitedJobsCollector) inherit(prev Collector) {
+	if p, ok := prev.(*exitedJobsCollector); ok {
+		c.exitedJobsState = p.exitedJobsState
+	}
+}
+
+// Update counts the jobs newly listed as exited by bjobs -d and exports the
+// totals.
+func (c *exitedJobsCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	err := c.parseExitedJobs(ctx)
+	for k, n := range c.exited {
+		ch <- prometheus.MustNewConstMetric(c.ExitedJobs, prometheus.CounterValue, n, k.queue, k.solver, k.value)
+	}
+	for k, n := range c.exitCodes {
+		ch <- prometheus.MustNewConstMetric(c.ExitCodes, prometheus.CounterValue, n, k.queue, k.solver, k.value)
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't get exited jobs: %w", err)
+	}
+	return nil
+}
+
+func (c *exitedJobsCollector) parseExitedJobs(ctx context.Context) error {
+	output, err := c.runner.Run(ctx, "bjobs", "-u", "all", "-d", "-o", "JOBID JOBINDEX STAT QUEUE APPLICATION EXIT_CODE EXIT_REASON", "-json")
+	if isErrorKind(err, ErrorKindNoJobs) {
+		c.logger.Debug("No recently finished job found")
+		c.seen = map[string]bool{}
+		c.primed = true
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	jobs, err := bjobs_JsontoStruct(output, c.logger)
+	if err != nil {
+		return newParseError("exited_jobs", "bjobs", err)
+	}
+
+	// bjobs -d lists the jobs finished within CLEAN_PERIOD, so a job left
+	// out of the output is never listed again and can be forgotten. The
+	// jobs listed on the first pass may have been counted before a restart
+	// and only fill seen.
+	seen := make(map[string]bool, len(jobs))
+	for _, j := range jobs {
+		if j.STATUS != "EXIT" {
+			continue
+		}
+		id := j.JOBID
+		if j.JOBINDEX != "" && j.JOBINDEX != "0" {
+			id += "[" + j.JOBINDEX + "]"
+		}
+		seen[id] = true
+		if c.seen[id] || !c.primed {
+			continue
+		}
+
+		solver := c.solvers.solver(j.APPLICATION, j.QUEUE)
+		c.exited[exitedJobsKey{j.QUEUE, solver, normalizeExitReason(j.EXIT_REASON)}]++
+		if code := strings.TrimSpace(j.EXIT_CODE); code != "" && code != "-" {
+			c.exitCodes[exitedJobsKey{j.QUEUE, solver, code}]++
+		}
+	}
+	c.seen = seen
+	c.primed = true
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package collector
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestExitedJobsCountsNewJobsOnly(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	const command = "bjobs -u all -d -o JOBID JOBINDEX STAT QUEUE APPLICATION EXIT_CODE EXIT_REASON -json"
+	runner := &FixtureRunner{
+		Dir:      filepath.Join("fixtures", "commands"),
+		Commands: map[string]string{command: "bjobs_exited_before.json"},
+	}
+	cfg := newFixtureConfig()
+	cfg.Runner = runner
+	c, err := NewExitedJobsCollector(logger, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The jobs listed by the first pass may have been counted before the
+	// exporter restarted.
+	metrics, err := updateMetrics(context.Background(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 0 {
+		t.Errorf("expected no job counted on the first pass, got %d series", len(metrics))
+	}
+
+	runner.Commands[command] = "bjobs_exited.json"
+	expected := `
+# HELP lsf_jobs_exit_code_total Number of jobs that exited, by exit code.
+# TYPE lsf_jobs_exit_code_total counter
+lsf_jobs_exit_code_total{exit_code="1",queue="normal",solver="Fluent"} 1
+lsf_jobs_exit_code_total{exit_code="137",queue="normal",solver="Fluent"} 1
+lsf_jobs_exit_code_total{exit_code="140",queue="abaqus",solver="Abaqus"} 1
+lsf_jobs_exit_code_total{exit_code="2",queue="short",solver="unknown"} 1
+# HELP lsf_jobs_exited_total Number of jobs that exited, by termination reason.
+# TYPE lsf_jobs_exited_total counter
+lsf_jobs_exited_total{exit_reason="TERM_MEMLIMIT",queue="normal",solver="Fluent"} 1
+lsf_jobs_exited_total{exit_reason="TERM_RUNLIMIT",queue="abaqus",solver="Abaqus"} 1
+lsf_jobs_exited_total{exit_reason="none",queue="normal",solver="Fluent"} 1
+lsf_jobs_exited_total{exit_reason="other",queue="short",solver="unknown"} 1
+`
+	if err := testutil.CollectAndCompare(updater{collector: c, t: t}, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,86 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics about the exporter itself, registered by RegisterExporterMetrics.
+var (
+	commandCoalescedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "command_coalesced_total",
+			Help:      "Number of LSF command invocations served by an identical invocation already in flight.",
+		},
+		[]string{"command"},
+	)
+	collectorCoalescedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "collector_coalesced_total",
+			Help:      "Number of collector updates served by an update of the same collector already in flight.",
+		},
+		[]string{"collector"},
+	)
+	commandErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "command_errors_total",
+			Help:      "Number of failed LSF commands, by reason from the LSF error catalogue.",
+		},
+		[]string{"command", "reason"},
+	)
+	commandDurationSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "command_duration_seconds",
+			Help:      "Duration of the LSF commands, from fork to exit.",
+			Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+		},
+		[]string{"command"},
+	)
+	commandFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "command_failures_total",
+			Help:      "Number of failed LSF commands, by class of error.",
+		},
+		[]string{"command", "class"},
+	)
+	commandOutputBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "command_output_bytes",
+			Help:      "Size of the standard output of the last successful run of an LSF command.",
+		},
+		[]string{"command"},
+	)
+	parseErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "exporter",
+			Name:      "parse_errors_total",
+			Help:      "Number of LSF command outputs or records a collector could not parse.",
+		},
+		[]string{"collector"},
+	)
+)
+
+// RegisterExporterMetrics registers the metrics about the exporter itself.
+func RegisterExporterMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(
+		commandCoalescedTotal,
+		collectorCoalescedTotal,
+		commandErrorsTotal,
+		commandDurationSeconds,
+		commandFailuresTotal,
+		commandOutputBytes,
+		parseErrorsTotal,
+	)
+}
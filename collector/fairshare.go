@@ -0,0 +1,162 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"lsf_exporter/config"
+)
+
+// shareAccount is a row of a SHARE_INFO_FOR table of bqueues -l or bhpart.
+type shareAccount struct {
+	// Pool is the queue or host partition of the account.
+	Pool string
+	// Path is the path of the account in the share tree, such as cfd/alice.
+	Path   string
+	Values map[string]float64
+}
+
+type fairshareCollector struct {
+	// metrics maps the columns of the SHARE_INFO_FOR tables to their desc.
+	metrics map[string]*prometheus.Desc
+	logger  *slog.Logger
+	runner  config.CommandRunner
+}
+
+func init() {
+	registerCollector("fairshare", defaultDisabled, NewFairshareCollector)
+}
+
+// NewFairshareCollector returns a new Collector exposing the share accounts
+// of the fairshare queues and host partitions.
+func NewFairshareCollector(logger *slog.Logger, config *config.Configuration) (Collector, error) {
+	labels := []string{"queue", "host_partition", "share_account"}
+	newDesc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "fairshare", name), help, labels, nil)
+	}
+	return &fairshareCollector{
+		metrics: map[string]*prometheus.Desc{
+			"SHARES":   newDesc("shares", "Number of shares assigned to the share account."),
+			"PRIORITY": newDesc("priority", "Dynamic share priority of the share account."),
+			"STARTED":  newDesc("started_slots", "Number of job slots used by the running and suspended jobs of the share account."),
+			"RESERVED": newDesc("reserved_slots", "Number of job slots reserved by the jobs of the share account."),
+			"CPU_TIME": newDesc("cpu_time_seconds", "Decayed CPU time used by the jobs of the share account, in seconds."),
+			"RUN_TIME": newDesc("run_time_seconds", "Decayed run time of the jobs of the share account, in seconds."),
+			"ADJUST":   newDesc("adjust_factor", "Dynamic priority adjustment of the share account, from the fairshare adjustment plugin."),
+		},
+		logger: logger,
+		runner: newCommandRunner(logger, config),
+	}, nil
+}
+
+// Update exports the share accounts of the queues, from bqueues -r -l, and
+// of the host partitions, from bhpart -r.
+func (c *fairshareCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	if err := c.collectShares(ctx, ch, "bqueues", "-r", "-l"); err != nil {
+		return fmt.Errorf("couldn't get queue fairshare infomation: %w", err)
+	}
+	if err := c.collectShares(ctx, ch, "bhpart", "-r"); err != nil {
+		return fmt.Errorf("couldn't get host partition fairshare infomation: %w", err)
+	}
+	return nil
+}
+
+func (c *fairshareCollector) collectShares(ctx context.Context, ch chan<- prometheus.Metric, command string, args ...string) error {
+	output, err := c.runner.Run(ctx, command, args...)
+	if isErrorKind(err, ErrorKindNoJobs) {
+		c.logger.Debug("No share account found", "command", command)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	accounts, err := parseShareInfo(output)
+	if err != nil {
+		return newParseError("fairshare", command, err)
+	}
+
+	for _, a := range accounts {
+		queue, partition := a.Pool, ""
+		if command == "bhpart" {
+			queue, partition = "", a.Pool
+		}
+		for column, v := range a.Values {
+			if desc, ok := c.metrics[column]; ok {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, queue, partition, a.Path)
+			}
+		}
+	}
+	return nil
+}
+
+// parseShareInfo returns the share accounts of the SHARE_INFO_FOR tables of
+// bqueues -l or bhpart. Each table lists the children of a node of the share
+// tree, named after the table as in "normal/cfd/", and ends with a blank
+// line. The other sections of the output are skipped.
+func parseShareInfo(out []byte) ([]shareAccount, error) {
+	var (
+		accounts     []shareAccount
+		pool, parent string
+		inTable      bool
+		header       []string
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if node, ok := strings.CutPrefix(line, "SHARE_INFO_FOR:"); ok {
+			pool, parent, _ = strings.Cut(strings.Trim(strings.TrimSpace(node), "/"), "/")
+			inTable, header = true, nil
+			continue
+		}
+		if !inTable {
+			continue
+		}
+		if line == "" {
+			inTable = false
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if header == nil {
+			if fields[0] != "USER/GROUP" {
+				return nil, fmt.Errorf("unexpected share table header %q", line)
+			}
+			header = fields
+			continue
+		}
+		if len(fields) != len(header) {
+			return nil, fmt.Errorf("share table row %q has %d fields, expected %d", line, len(fields), len(header))
+		}
+
+		a := shareAccount{
+			Pool:   pool,
+			Path:   strings.TrimSuffix(fields[0], "/"),
+			Values: make(map[string]float64, len(header)-1),
+		}
+		if parent != "" {
+			a.Path = parent + "/" + a.Path
+		}
+		for i, column := range header[1:] {
+			s := fields[i+1]
+			if s == "-" {
+				continue
+			}
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q for %s: %w", column, s, a.Path, err)
+			}
+			a.Values[column] = v
+		}
+		accounts = append(accounts, a)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
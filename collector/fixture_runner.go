@@ -0,0 +1,37 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FixtureRunner is a config.CommandRunner replaying captured LSF command
+// output, so that collectors can be exercised without an LSF cluster.
+type FixtureRunner struct {
+	// Dir is the directory holding the captured output files.
+	Dir string
+	// Commands maps a command line, as formatted by commandLine, to the
+	// name of the file in Dir holding its output.
+	Commands map[string]string
+}
+
+// Run returns the content of the fixture file mapped to the command line.
+func (r *FixtureRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	line := commandLine(name, args...)
+	file, ok := r.Commands[line]
+	if !ok {
+		return nil, fmt.Errorf("no fixture for command '%s'", line)
+	}
+
+	out, err := os.ReadFile(filepath.Join(r.Dir, file))
+	if err != nil {
+		return nil, fmt.Errorf("error while reading fixture for '%s': %w", line, err)
+	}
+	return out, nil
+}
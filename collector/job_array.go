@@ -0,0 +1,113 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+
+	"github.com/jszwec/csvutil"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// arrayJobIDRegex matches the ID of an array element, as in 1234[17].
+	arrayJobIDRegex = regexp.MustCompile(`^(\d+)\[(\d+)\]$`)
+	// arraySpecRegex matches the index ranges of an ARRAY_SPEC, as in
+	// sweep[1-100:2]%10.
+	arraySpecRegex = regexp.MustCompile(`\[[^\]]*\](%\d+)?$`)
+)
+
+// parseArrayJobID returns the parent job ID and the index of an array
+// element, read from its JOBID or else from its JOBINDEX. ok is false for the
+// jobs that are not array elements.
+func parseArrayJobID(id, index string) (parent, elem string, ok bool) {
+	if m := arrayJobIDRegex.FindStringSubmatch(id); m != nil {
+		return m[1], m[2], true
+	}
+	if index != "" && index != "0" {
+		return id, index, true
+	}
+	return "", "", false
+}
+
+func bjobsArrays_CsvtoStruct(lsfOutput []byte, logger *slog.Logger) ([]bjobsArrayInfo, error) {
+	csv_out := csv.NewReader(TrimReader{bytes.NewReader(lsfOutput)})
+	csv_out.LazyQuotes = true
+	csv_out.Comma = ' '
+	csv_out.TrimLeadingSpace = true
+
+	dec, err := csvutil.NewDecoder(csv_out)
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error decoding CSV header: %w", err)
+	}
+
+	var arrays []bjobsArrayInfo
+	for {
+		var a bjobsArrayInfo
+		if err := dec.Decode(&a); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("error decoding record: %w", err)
+		}
+		arrays = append(arrays, a)
+	}
+	return arrays, nil
+}
+
+// collectArrays sends the number of elements of each job array in each
+// state and the share of its elements that finished, from bjobs -A. bjobs
+// is only run when jobs holds array elements. When it fails, the error is
+// logged, the runner having counted it, so that the other job metrics are
+// still exported.
+func (c *JobCollector) collectArrays(ctx context.Context, ch chan<- prometheus.Metric, jobs []Job) {
+	found := false
+	for _, j := range jobs {
+		if j.ArrayID != "" {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return
+	}
+
+	output, err := c.runner.Run(ctx, "bjobs", "-A", "-w", "-u", "all")
+	if isErrorKind(err, ErrorKindNoJobs) {
+		return
+	} else if err != nil {
+		c.logger.Warn("Couldn't get job arrays, skipping job array metrics", "err", err)
+		return
+	}
+	arrays, err := bjobsArrays_CsvtoStruct(output, c.logger)
+	if err != nil {
+		c.logger.Warn("Couldn't get job arrays, skipping job array metrics", "err", newParseError("lsfjob", "bjobs", err))
+		return
+	}
+
+	for _, a := range arrays {
+		name := arraySpecRegex.ReplaceAllString(a.ARRAY_SPEC, "")
+		for _, s := range []struct {
+			state string
+			n     float64
+		}{
+			{"PEND", a.PEND},
+			{"RUN", a.RUN},
+			{"DONE", a.DONE},
+			{"EXIT", a.EXIT},
+			{"SSUSP", a.SSUSP},
+			{"USUSP", a.USUSP},
+			{"PSUSP", a.PSUSP},
+		} {
+			ch <- prometheus.MustNewConstMetric(c.ArrayElements, prometheus.GaugeValue, s.n, a.JOBID, name, a.OWNER, s.state)
+		}
+		if a.NJOBS > 0 {
+			ch <- prometheus.MustNewConstMetric(c.ArrayProgress, prometheus.GaugeValue, (a.DONE+a.EXIT)/a.NJOBS, a.JOBID, name, a.OWNER)
+		}
+	}
+}
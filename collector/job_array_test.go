@@ -0,0 +1,36 @@
+package collector
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestJobArraysFailureKeepsJobMetrics(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	// Without a fixture, bjobs -A fails.
+	c, err := NewLSFJobCollector(logger, newFixtureConfigWithout("bjobs -A -w -u all"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, err := updateMetrics(context.Background(), c)
+	if err != nil {
+		t.Fatalf("expected the job metrics despite the failure of bjobs -A, got %v", err)
+	}
+	if len(metrics) == 0 {
+		t.Error("expected job metrics, got none")
+	}
+	arrayDescs := map[*prometheus.Desc]bool{
+		c.(*JobCollector).ArrayElements: true,
+		c.(*JobCollector).ArrayProgress: true,
+	}
+	for _, m := range metrics {
+		if arrayDescs[m.Desc()] {
+			t.Errorf("expected no job array metric, got %s", m.Desc())
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"lsf_exporter/config"
+)
+
+// lsbShareDir returns LSB_SHAREDIR, taken from the exporter's environment,
+// then from the profile.lsf and lsf.conf of opts.
+func lsbShareDir(opts config.CliOpts) (string, error) {
+	if dir := os.Getenv("LSB_SHAREDIR"); dir != "" {
+		return dir, nil
+	}
+	env, err := LoadEnvironment(opts)
+	if err != nil {
+		return "", err
+	}
+	if dir := env.Vars["LSB_SHAREDIR"]; dir != "" {
+		return dir, nil
+	}
+	envDir := env.EnvDir
+	if envDir == "" {
+		envDir = "/etc"
+	}
+	vars, err := parseAssignments(filepath.Join(envDir, "lsf.conf"), false)
+	if err != nil {
+		return "", err
+	}
+	if dir := vars["LSB_SHAREDIR"]; dir != "" {
+		return dir, nil
+	}
+	return "", errors.New("LSB_SHAREDIR is not set in the environment, profile.lsf or lsf.conf")
+}
+
+// lsbLogFile returns the path of a file of the mbatchd log directory,
+// $LSB_SHAREDIR/<cluster>/logdir/<name>. The cluster is cfg.ClusterName,
+// or the only cluster found under LSB_SHAREDIR.
+func lsbLogFile(cfg *config.Configuration, name string) (string, error) {
+	shareDir, err := lsbShareDir(cfg.CliOpts)
+	if err != nil {
+		return "", err
+	}
+	if cfg.ClusterName != "" {
+		return filepath.Join(shareDir, cfg.ClusterName, "logdir", name), nil
+	}
+	matches, err := filepath.Glob(filepath.Join(shareDir, "*", "logdir", name))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) != 1 {
+		return "", fmt.Errorf("found %d %s files under %s, set cluster_name", len(matches), name, shareDir)
+	}
+	return matches[0], nil
+}
+
+// newLogTailer returns a logTailer of the file set in opts, or else of the
+// file called name in the mbatchd log directory.
+func newLogTailer(logger *slog.Logger, cfg *config.Configuration, opts config.LogFile, name string) (*logTailer, error) {
+	path := opts.File
+	if path == "" {
+		var err error
+		if path, err = lsbLogFile(cfg, name); err != nil {
+			return nil, err
+		}
+	}
+	logger.Info("Reading LSF log file", "path", path)
+	return &logTailer{
+		path:          path,
+		stateFile:     opts.StateFile,
+		fromBeginning: opts.FromBeginning,
+		logger:        logger,
+	}, nil
+}
+
+// sameLogFile reports whether a tailer of the file set in optsA under a
+// resolves to the same file as one of the file set in optsB under b, so
+// that it can be kept on reload.
+func sameLogFile(a, b *config.Configuration, optsA, optsB config.LogFile) bool {
+	return optsA == optsB && a.ClusterName == b.ClusterName && a.CliOpts == b.CliOpts
+}
+
+// splitLSBRecord splits a line of lsb.acct or lsb.events into its fields.
+// Fields are separated by spaces; strings are quoted, with "" standing for
+// a quote inside them.
+func splitLSBRecord(line string) ([]string, error) {
+	fields := []string{}
+	for i := 0; i < len(line); {
+		switch line[i] {
+		case ' ', '\t', '\r', '\n':
+			i++
+		case '"':
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(line) {
+					return nil, errors.New("unterminated quoted string")
+				}
+				if line[i] == '"' {
+					if i+1 < len(line) && line[i+1] == '"' {
+						b.WriteByte('"')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				b.WriteByte(line[i])
+				i++
+			}
+			fields = append(fields, b.String())
+		default:
+			j := i
+			for j < len(line) && line[j] != ' ' && line[j] != '\t' && line[j] != '\r' && line[j] != '\n' {
+				j++
+			}
+			fields = append(fields, line[i:j])
+			i = j
+		}
+	}
+	return fields, nil
+}
+
+// lsbFields reads the fields of an lsb record in order. The first error is
+// kept and later reads return zero values.
+type lsbFields struct {
+	fields []string
+	pos    int
+	err    error
+}
+
+func (f *lsbFields) next() string {
+	if f.err != nil {
+		return ""
+	}
+	if f.pos >= len(f.fields) {
+		f.err = fmt.Errorf("record has only %d fields", len(f.fields))
+		return ""
+	}
+	f.pos++
+	return f.fields[f.pos-1]
+}
+
+func (f *lsbFields) str() string {
+	return f.next()
+}
+
+func (f *lsbFields) int() int64 {
+	s := f.next()
+	if f.err != nil {
+		return 0
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		f.err = fmt.Errorf("field %d: %w", f.pos, err)
+	}
+	return v
+}
+
+func (f *lsbFields) float() float64 {
+	s := f.next()
+	if f.err != nil {
+		return 0
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		f.err = fmt.Errorf("field %d: %w", f.pos, err)
+	}
+	return v
+}
+
+// skip skips n fields.
+func (f *lsbFields) skip(n int) {
+	for i := 0; i < n && f.err == nil; i++ {
+		f.next()
+	}
+}
+
+// skipList skips a list of fields preceded by its length.
+func (f *lsbFields) skipList() {
+	f.skip(int(f.int()))
+}
+
+// logTailer reads the lines appended to an LSF log file since the last call.
+// It follows the file when LSF renames it to <path>.1 and starts a new one,
+// and can keep its position in a state file across restarts.
+type logTailer struct {
+	path string
+	// stateFile keeps the offset and the file identity. Empty disables it.
+	stateFile string
+	// fromBeginning reads a file seen for the first time from its start
+	// rather than from its end.
+	fromBeginning bool
+	logger        *slog.Logger
+
+	loaded bool
+	offset int64
+	id     uint64
+	info   os.FileInfo
+}
+
+// read calls fn for every complete line appended to the file since the last
+// call. Lines are consumed as fn is called, so that a cancelled ctx does not
+// lose the progress made.
+func (t *logTailer) read(ctx context.Context, fn func(line string)) error {
+	if !t.loaded {
+		t.loadState()
+	}
+
+	fi, err := os.Stat(t.path)
+	if err != nil {
+		return err
+	}
+
+	if t.info == nil && !t.loaded {
+		// First time this file is seen.
+		t.id = fileID(fi)
+		if !t.fromBeginning {
+			t.offset = fi.Size()
+		}
+	} else if rotated := t.rotated(fi); rotated || fi.Size() < t.offset {
+		if rotated {
+			t.finishRotated(ctx, fn)
+		} else {
+			t.logger.Info("Log file truncated, reading it from the start", "path", t.path)
+		}
+		t.offset = 0
+	}
+	t.loaded = true
+	t.info = fi
+	t.id = fileID(fi)
+
+	err = t.readFrom(ctx, t.path, fn)
+	t.saveState()
+	return err
+}
+
+// rotated reports whether the file at t.path is not the one read so far.
+func (t *logTailer) rotated(fi os.FileInfo) bool {
+	if t.info != nil {
+		return !os.SameFile(t.info, fi)
+	}
+	return t.id != 0 && t.id != fileID(fi)
+}
+
+// finishRotated reads the end of the file read so far, now renamed to
+// <path>.1, when it can be found.
+func (t *logTailer) finishRotated(ctx context.Context, fn func(line string)) {
+	old := t.path + ".1"
+	fi, err := os.Stat(old)
+	if err != nil || (t.info != nil && !os.SameFile(t.info, fi)) || (t.info == nil && fileID(fi) != t.id) {
+		t.logger.Info("Log file rotated, reading the new one from the start", "path", t.path)
+		return
+	}
+	t.logger.Info("Log file rotated, reading the rest of the old one", "path", old)
+	if err := t.readFrom(ctx, old, fn); err != nil {
+		t.logger.Warn("Couldn't read the rotated log file", "path", old, "err", err)
+	}
+}
+
+// readFrom reads the complete lines of path from t.offset.
+func (t *logTailer) readFrom(ctx context.Context, path string, fn func(line string)) error {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(t.offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	r := bufio.NewReaderSize(f, 64*1024)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			// A partial line is left for the next call.
+			return nil
+		} else if err != nil {
+			return err
+		}
+		t.offset += int64(len(line))
+		fn(strings.TrimRight(line, "\r\n"))
+	}
+}
+
+// loadState reads the offset and file identity saved in the state file.
+func (t *logTailer) loadState() {
+	if t.stateFile == "" {
+		return
+	}
+	content, err := os.ReadFile(filepath.Clean(t.stateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	} else if err != nil {
+		t.logger.Warn("Couldn't read the state file", "path", t.stateFile, "err", err)
+		return
+	}
+	var offset int64
+	var id uint64
+	if _, err := fmt.Sscanf(string(content), "%d %d", &offset, &id); err != nil {
+		t.logger.Warn("Couldn't parse the state file", "path", t.stateFile, "err", err)
+		return
+	}
+	t.offset, t.id, t.loaded = offset, id, true
+}
+
+// saveState writes the offset and file identity to the state file.
+func (t *logTailer) saveState() {
+	if t.stateFile == "" {
+		return
+	}
+	tmp := t.stateFile + ".tmp"
+	content := fmt.Sprintf("%d %d\n", t.offset, t.id)
+	if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+		t.logger.Warn("Couldn't write the state file", "path", t.stateFile, "err", err)
+		return
+	}
+	if err := os.Rename(tmp, t.stateFile); err != nil {
+		t.logger.Warn("Couldn't write the state file", "path", t.stateFile, "err", err)
+	}
+}
@@ -0,0 +1,122 @@
+package collector
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitLSBRecord(t *testing.T) {
+	got, err := splitLSBRecord(`"JOB_FINISH" "10.1" 1700000000 "say ""hi""" "" -1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"JOB_FINISH", "10.1", "1700000000", `say "hi"`, "", "-1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("splitLSBRecord() = %q; want %q", got, want)
+	}
+
+	if _, err := splitLSBRecord(`"JOB_FINISH" "unterminated`); err == nil {
+		t.Error("splitLSBRecord() should fail on an unterminated string")
+	}
+}
+
+func TestLogTailer(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "lsb.acct")
+	state := filepath.Join(dir, "state")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	write := func(name, content string) {
+		t.Helper()
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(tailer *logTailer) []string {
+		t.Helper()
+		lines := []string{}
+		if err := tailer.read(context.Background(), func(line string) { lines = append(lines, line) }); err != nil {
+			t.Fatal(err)
+		}
+		return lines
+	}
+	newTailer := func() *logTailer {
+		return &logTailer{path: path, stateFile: state, fromBeginning: true, logger: logger}
+	}
+
+	write(path, "a\nb\npartial")
+	tailer := newTailer()
+	if got := read(tailer); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("first read = %q", got)
+	}
+
+	write(path, " line\nc\n")
+	if got := read(tailer); !reflect.DeepEqual(got, []string{"partial line", "c"}) {
+		t.Errorf("read after append = %q", got)
+	}
+
+	// A new tailer resumes from the state file.
+	write(path, "d\n")
+	tailer = newTailer()
+	if got := read(tailer); !reflect.DeepEqual(got, []string{"d"}) {
+		t.Errorf("read after restart = %q", got)
+	}
+
+	// The end of the rotated file is read before the new file.
+	write(path, "e\n")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	write(path, "f\n")
+	if got := read(tailer); !reflect.DeepEqual(got, []string{"e", "f"}) {
+		t.Errorf("read after rotation = %q", got)
+	}
+
+	// A truncated file is read from the start.
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(tailer); len(got) != 0 {
+		t.Errorf("read of the truncated file = %q", got)
+	}
+	write(path, "g\n")
+	if got := read(tailer); !reflect.DeepEqual(got, []string{"g"}) {
+		t.Errorf("read after truncation = %q", got)
+	}
+}
+
+func TestLogTailerStartsAtEnd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lsb.acct")
+	if err := os.WriteFile(path, []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tailer := &logTailer{path: path, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	lines := []string{}
+	collect := func(line string) { lines = append(lines, line) }
+	if err := tailer.read(context.Background(), collect); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("new\n")
+	f.Close()
+	if err := tailer.read(context.Background(), collect); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(lines, []string{"new"}) {
+		t.Errorf("lines = %q; want only the appended one", lines)
+	}
+}
@@ -2,10 +2,10 @@ package collector
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
-	"os/exec"
 	"strings"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -13,17 +13,29 @@ import (
 	"lsf_exporter/config"
 )
 
+// GetSolverMapping returns the solver mapping read from filePath. Errors are
+// logged and yield the entries read so far.
 func GetSolverMapping(filePath string) map[string]string {
+	solverMap, err := LoadSolverMapping(filePath)
+	if err != nil {
+		slog.Error("GetSolverMapping: Failed to read solver mapping file", "path", filePath, "err", err)
+	}
+	return solverMap
+}
+
+// LoadSolverMapping reads the solver standardization mapping from filePath,
+// one "application or queue,solver" pair per line. An empty filePath yields
+// an empty mapping.
+func LoadSolverMapping(filePath string) (map[string]string, error) {
 	solverMap := make(map[string]string)
 	if filePath == "" {
-		return solverMap
+		return solverMap, nil
 	}
 
-	slog.Debug("GetSolverMapping: Attempting to open solver mapping file", "path", filePath)
+	slog.Debug("LoadSolverMapping: Attempting to open solver mapping file", "path", filePath)
 	file, err := os.Open(filePath)
 	if err != nil {
-		slog.Error("GetSolverMapping: Failed to open solver mapping file", "path", filePath, "err", err)
-		return solverMap
+		return solverMap, fmt.Errorf("couldn't open solver mapping: %w", err)
 	}
 	defer file.Close()
 
@@ -35,22 +47,58 @@ func GetSolverMapping(filePath string) map[string]string {
 			allowedKey := strings.ToLower(strings.TrimSpace(parts[0]))
 			solverLabel := strings.TrimSpace(parts[1])
 			solverMap[allowedKey] = solverLabel
-			slog.Debug("GetSolverMapping: Parsed mapping", "raw_line", line, "key_part", parts[0], "value_part", parts[1], "allowedKey", allowedKey, "solverLabel", solverLabel)
+			slog.Debug("LoadSolverMapping: Parsed mapping", "raw_line", line, "key_part", parts[0], "value_part", parts[1], "allowedKey", allowedKey, "solverLabel", solverLabel)
 		} else {
-			slog.Debug("GetSolverMapping: Skipping line (not 2 parts)", "raw_line", line)
+			slog.Debug("LoadSolverMapping: Skipping line (not 2 parts)", "raw_line", line)
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		slog.Error("GetSolverMapping: Error reading solver mapping file", "path", filePath, "err", err)
+		return solverMap, fmt.Errorf("couldn't read solver mapping: %w", err)
 	}
-	slog.Debug("GetSolverMapping: Loaded solver map", "map", solverMap)
-	return solverMap
+	slog.Debug("LoadSolverMapping: Loaded solver map", "map", solverMap)
+	return solverMap, nil
+}
+
+// solverMapper standardizes the solver of jobs.
+type solverMapper struct {
+	mapping map[string]string
+	unknown string
+}
+
+// newSolverMapper returns the solverMapper of config, reading the mapping
+// file when config does not hold it already.
+func newSolverMapper(config *config.Configuration) solverMapper {
+	mapping := config.SolverMap
+	if mapping == nil {
+		mapping = GetSolverMapping(config.CliOpts.LsfStdSolverConfig)
+	}
+	unknown := config.Labels.UnknownSolver
+	if unknown == "" {
+		unknown = "unknown"
+	}
+	return solverMapper{mapping: mapping, unknown: unknown}
+}
+
+// solver returns the standardized solver of a job, from its application
+// profile or else its queue.
+func (m solverMapper) solver(application, queue string) string {
+	name := application
+	if name == "" {
+		name = queue
+	}
+	if s := m.mapping[strings.ToLower(name)]; s != "" {
+		return s
+	}
+	return m.unknown
 }
 
 type InformationCollector struct {
 	LsfInformation *prometheus.Desc
 	logger         *slog.Logger
+	runner         config.CommandRunner
+	// clusterName overrides the cluster name reported by lsid when set.
+	clusterName string
 }
 
 func init() {
@@ -66,19 +114,21 @@ func NewLSFInformationCollector(logger *slog.Logger, config *config.Configuratio
 			"A metric with a constant '1' value labeled by ClusterName, MasterName and Version of the IBM Spectrum LSF .",
 			[]string{"clustername", "mastername", "version"}, nil,
 		),
-		logger: logger,
+		logger:      logger,
+		runner:      newCommandRunner(logger, config),
+		clusterName: config.ClusterName,
 	}, nil
 }
 
 // Update calls (*lmstatCollector).getLmStat to get the platform specific
 // memory metrics.
-func (c *InformationCollector) Update(ch chan<- prometheus.Metric) error {
+func (c *InformationCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	// err := c.getLmstatInfo(ch)
 	// if err != nil {
 	// 	return fmt.Errorf("couldn't get lmstat version information: %w", err)
 	// }
 
-	err := c.parsebLsfClusterInfo(ch)
+	err := c.parsebLsfClusterInfo(ctx, ch)
 	if err != nil {
 		return fmt.Errorf("couldn't get queues infomation: %w", err)
 	}
@@ -86,42 +136,10 @@ func (c *InformationCollector) Update(ch chan<- prometheus.Metric) error {
 	return nil
 }
 
-func lsfOutput(logger *slog.Logger, exe_file string, args ...string) ([]byte, error) {
-	// _, err := os.Stat(*LSF_BINDIR)
-	// if os.IsNotExist(err) {
-	// 	logger.Error("err", "err", *LSF_BINDIR, "missing")
-	// 	os.Exit(1)
-	// }
-
-	// _, err = os.Stat(*LSF_SERVERDIR)
-	// if os.IsNotExist(err) {
-	// 	logger.Error("err", "err", *LSF_SERVERDIR, "missing")
-	// 	os.Exit(1)
-	// }
-
-	// _, err = os.Stat(*LSF_ENVDIR)
-	// if os.IsNotExist(err) {
-	// 	logger.Error("err", "err", *LSF_ENVDIR, "missing")
-	// 	os.Exit(1)
-	// }
-
-	cmd := exec.Command(exe_file, args...)
-
-	out, err := cmd.Output()
-
+func (c *InformationCollector) parsebLsfClusterInfo(ctx context.Context, ch chan<- prometheus.Metric) error {
+	output, err := c.runner.Run(ctx, "lsid", "")
 	if err != nil {
-		return nil, fmt.Errorf("error while calling '%s %s': %v:'unknown error'",
-			exe_file, strings.Join(args, " "), err)
-	}
-
-	return out, nil
-}
-
-func (c *InformationCollector) parsebLsfClusterInfo(ch chan<- prometheus.Metric) error {
-	output, err := lsfOutput(c.logger, "lsid", "")
-	if err != nil {
-		c.logger.Error("Failed to get lsid output", "err", err)
-		return nil
+		return err
 	}
 	lsf_summary := string(output)
 	md := map[string]string{}
@@ -149,6 +167,10 @@ func (c *InformationCollector) parsebLsfClusterInfo(ch chan<- prometheus.Metric)
 		}
 	}
 
+	if c.clusterName != "" {
+		md["cluster_name"] = c.clusterName
+	}
+
 	//	c.logger.Debug("当前集群名称：", "cluster_name", md["cluster_name"], ",当前的master节点名是:", "master_name", md["master_name"], ",版本是:", "lsf_version", md["lsf_version"])
 	c.logger.Debug("Current cluster info",
 		"cluster_name", md["cluster_name"],
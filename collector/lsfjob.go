@@ -2,13 +2,16 @@ package collector
 
 import (
 	"bytes"
+	"context"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jszwec/csvutil"
 	"github.com/prometheus/client_golang/prometheus"
@@ -42,6 +45,159 @@ type Job struct {
 	DstJobid      string
 	SrcCluster    string
 	DstCluster    string
+	Mem           string
+	MaxMem        string
+	AvgMem        string
+	Swap          string
+	CPUUsed       string
+	RunTime       string
+	MemLimit      string
+	RunTimeLimit  string
+	ResReq        string
+	// ArrayID and ArrayIndex are the parent job ID and the index of an
+	// array element, and are empty for other jobs.
+	ArrayID    string
+	ArrayIndex string
+}
+
+// defaultAggregateBy are the labels of the aggregated job metrics when
+// jobs.aggregate_by is not set.
+var defaultAggregateBy = []string{"queue", "user", "project", "status", "solver", "application"}
+
+// jobLabels are the labels the aggregated job metrics can be grouped by.
+var jobLabels = map[string]func(j *Job) string{
+	"queue":       func(j *Job) string { return j.Queue },
+	"user":        func(j *Job) string { return j.User },
+	"user_group":  func(j *Job) string { return j.UserGroup },
+	"project":     func(j *Job) string { return j.Project },
+	"status":      func(j *Job) string { return j.Status },
+	"solver":      func(j *Job) string { return j.Solver },
+	"application": func(j *Job) string { return j.Application },
+	"job_group":   func(j *Job) string { return j.JGroup },
+	"from_host":   func(j *Job) string { return j.FromHost },
+}
+
+// defaultPendingTimeBuckets are the buckets of the pending time histograms
+// when jobs.pending_time_buckets is not set.
+var defaultPendingTimeBuckets = []time.Duration{
+	time.Minute, 5 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 2 * time.Hour, 4 * time.Hour, 8 * time.Hour, 12 * time.Hour,
+	24 * time.Hour, 48 * time.Hour, 7 * 24 * time.Hour,
+}
+
+// jobUsage is a resource usage field of bjobs, exported per job as
+// lsf_bjobs_<name> and, when sumHelp is set, summed per queue, user and
+// project as lsf_jobs_<name>.
+type jobUsage struct {
+	name    string
+	help    string
+	sumHelp string
+	value   func(j *Job) (float64, bool)
+}
+
+var jobUsages = []jobUsage{
+	{"mem_bytes", "Memory used by the job (MEM).", "Memory used by unfinished jobs (MEM).",
+		func(j *Job) (float64, bool) { return parseLSFMemory(j.Mem) }},
+	{"max_mem_bytes", "Peak memory used by the job (MAX_MEM).", "Sum of the peak memory used by unfinished jobs (MAX_MEM).",
+		func(j *Job) (float64, bool) { return parseLSFMemory(j.MaxMem) }},
+	{"avg_mem_bytes", "Average memory used by the job (AVG_MEM).", "",
+		func(j *Job) (float64, bool) { return parseLSFMemory(j.AvgMem) }},
+	{"swap_bytes", "Swap used by the job (SWAP).", "Swap used by unfinished jobs (SWAP).",
+		func(j *Job) (float64, bool) { return parseLSFMemory(j.Swap) }},
+	{"cpu_time_seconds", "CPU time used by the job (CPU_USED).", "CPU time used by unfinished jobs (CPU_USED).",
+		func(j *Job) (float64, bool) { return parseLSFDuration(j.CPUUsed, 1) }},
+	{"run_time_seconds", "Wall-clock run time of the job (RUN_TIME).", "Wall-clock run time of unfinished jobs (RUN_TIME).",
+		func(j *Job) (float64, bool) { return parseLSFDuration(j.RunTime, 1) }},
+	{"mem_limit_bytes", "Memory limit of the job (MEMLIMIT).", "",
+		func(j *Job) (float64, bool) { return parseLSFMemory(j.MemLimit) }},
+	{"run_time_limit_seconds", "Run time limit of the job (RUNTIMELIMIT).", "",
+		func(j *Job) (float64, bool) { return parseLSFDuration(j.RunTimeLimit, 60) }},
+}
+
+// labelID returns the ID of the job with the index of array elements, as in
+// 1234[17], so that the elements of an array, which share their JOBID, have
+// series of their own.
+func (j *Job) labelID() string {
+	if j.ArrayIndex != "" && !strings.Contains(j.ID, "[") {
+		return j.ID + "[" + j.ArrayIndex + "]"
+	}
+	return j.ID
+}
+
+// jobLabel is a label of the per-job metrics.
+type jobLabel struct {
+	name  string
+	value func(j *Job) string
+}
+
+// jobLabelFields maps the bjobs fields that can be selected with jobs.labels
+// to the labels of the per-job metrics. SOLVER is the standardized solver.
+var jobLabelFields = map[string]jobLabel{
+	"JOBID":        {"ID", func(j *Job) string { return j.labelID() }},
+	"USER":         {"User", func(j *Job) string { return j.User }},
+	"STAT":         {"Status", func(j *Job) string { return j.Status }},
+	"QUEUE":        {"Queue", func(j *Job) string { return j.Queue }},
+	"FROM_HOST":    {"FromHost", func(j *Job) string { return j.FromHost }},
+	"EXEC_HOST":    {"ExecutionHost", func(j *Job) string { return j.ExecutionHost }},
+	"JOB_NAME":     {"JobName", func(j *Job) string { return j.JobName }},
+	"UGROUP":       {"UserGroup", func(j *Job) string { return j.UserGroup }},
+	"PROJECT":      {"Project", func(j *Job) string { return j.Project }},
+	"APPLICATION":  {"Application", func(j *Job) string { return j.Application }},
+	"SOLVER":       {"Solver", func(j *Job) string { return j.Solver }},
+	"JOB_GROUP":    {"JGroup", func(j *Job) string { return j.JGroup }},
+	"DEPENDENCY":   {"Dependency", func(j *Job) string { return j.Dependency }},
+	"NALLOC_SLOT":  {"NSlot", func(j *Job) string { return j.NSlot }},
+	"MIN_REQ_PROC": {"NProc", func(j *Job) string { return j.NProc }},
+	"START_TIME":   {"StartTime", func(j *Job) string { return j.StartTime }},
+	"SUB_CWD":      {"SubCWD", func(j *Job) string { return j.SubCWD }},
+	"PEND_TIME":    {"PendTime", func(j *Job) string { return j.PendTime }},
+	"EPENDTIME":    {"EPendTime", func(j *Job) string { return j.EPendTime }},
+	"IPENDTIME":    {"IPendTime", func(j *Job) string { return j.IPendTime }},
+	"SRCJOBID":     {"SrcJobid", func(j *Job) string { return j.SrcJobid }},
+	"DSTJOBID":     {"DstJobid", func(j *Job) string { return j.DstJobid }},
+	"SRCLUSTER":    {"SrcCluster", func(j *Job) string { return j.SrcCluster }},
+	"FWD_CLUSTER":  {"DstCluster", func(j *Job) string { return j.DstCluster }},
+	"SUBMIT_TIME":  {"SubmitTime", func(j *Job) string { return j.SubmitTime }},
+}
+
+// defaultJobLabelFields are the labels of the per-job metrics when
+// jobs.labels is not set.
+var defaultJobLabelFields = []string{
+	"JOBID", "USER", "STAT", "QUEUE", "FROM_HOST", "EXEC_HOST", "JOB_NAME",
+	"UGROUP", "PROJECT", "APPLICATION", "SOLVER", "JOB_GROUP", "DEPENDENCY",
+	"NALLOC_SLOT", "MIN_REQ_PROC", "START_TIME", "SUB_CWD", "PEND_TIME",
+	"EPENDTIME", "IPENDTIME", "SRCJOBID", "DSTJOBID", "SRCLUSTER",
+	"FWD_CLUSTER", "SUBMIT_TIME",
+}
+
+// validateJobsConfig checks the fields of jobs.labels and the labels of
+// jobs.aggregate_by.
+func validateJobsConfig(jobs config.Jobs) error {
+	seen := map[string]bool{}
+	for _, f := range jobs.Labels {
+		if _, ok := jobLabelFields[f]; !ok {
+			return fmt.Errorf("unknown bjobs field %q in jobs.labels, expected one of %s", f, strings.Join(defaultJobLabelFields, ", "))
+		}
+		if seen[f] {
+			return fmt.Errorf("duplicate field %q in jobs.labels", f)
+		}
+		seen[f] = true
+	}
+	if len(jobs.Labels) > 0 && !seen["JOBID"] {
+		return errors.New("jobs.labels must include JOBID, which tells the series of the jobs and array elements apart")
+	}
+
+	seen = map[string]bool{}
+	for _, l := range jobs.AggregateBy {
+		if _, ok := jobLabels[l]; !ok {
+			return fmt.Errorf("unknown label %q in jobs.aggregate_by", l)
+		}
+		if seen[l] {
+			return fmt.Errorf("duplicate label %q in jobs.aggregate_by", l)
+		}
+		seen[l] = true
+	}
+	return nil
 }
 
 type JobCollector struct {
@@ -50,8 +206,37 @@ type JobCollector struct {
 	JobInfoEPendingTime *prometheus.Desc
 	JobInfoIPendingTime *prometheus.Desc
 	//	JobInfo *prometheus.Desc
-	logger    *slog.Logger
-	solverMap map[string]string
+	JobStates                      *prometheus.Desc
+	PendingTimeHistogram           *prometheus.Desc
+	EligiblePendingTimeHistogram   *prometheus.Desc
+	IneligiblePendingTimeHistogram *prometheus.Desc
+	Usage                          []*prometheus.Desc
+	UsageSum                       []*prometheus.Desc
+	RequestedMem                   *prometheus.Desc
+	CPUEfficiency                  *prometheus.Desc
+	MemEfficiency                  *prometheus.Desc
+	GroupCPUEfficiency             *prometheus.Desc
+	GroupMemEfficiency             *prometheus.Desc
+	GroupJobs                      *prometheus.Desc
+	GroupSlots                     *prometheus.Desc
+	GroupRequestedSlots            *prometheus.Desc
+	GroupPendingTime               *prometheus.Desc
+	GroupPendingTimeMax            *prometheus.Desc
+	ArrayElements                  *prometheus.Desc
+	ArrayProgress                  *prometheus.Desc
+	DependencyBlocked              *prometheus.Desc
+	DependencyNever                *prometheus.Desc
+	DependencyDepth                *prometheus.Desc
+	logger                         *slog.Logger
+	runner                         config.CommandRunner
+	solvers                        solverMapper
+	perJob                         bool
+	labels                         []jobLabel
+	aggregate                      bool
+	aggregateBy                    []string
+	pendingBuckets                 []float64
+	rusageMemPerSlot               bool
+	collapseArrays                 bool
 }
 
 func init() {
@@ -61,35 +246,45 @@ func init() {
 // NewLSFJobCollector returns a new Collector exposing job info
 func NewLSFJobCollector(logger *slog.Logger, config *config.Configuration) (Collector, error) {
 	logger.Debug("LSFJobCollector: LsfStdSolverConfig path:", "path", config.CliOpts.LsfStdSolverConfig)
-	solverMap := GetSolverMapping(config.CliOpts.LsfStdSolverConfig)
-	logger.Debug("LSFJobCollector: Loaded solver mappings", "count", len(solverMap))
-
-	labelsName := []string{
-		"ID",
-		"User",
-		"Status",
-		"Queue",
-		"FromHost",
-		"ExecutionHost",
-		"JobName",
-		"UserGroup",
-		"Project",
-		"Application",
-		"Solver",
-		"JGroup",
-		"Dependency",
-		"NSlot",
-		"NProc",
-		"StartTime",
-		"SubCWD",
-		"PendTime",
-		"EPendTime",
-		"IPendTime",
-		"SrcJobid",
-		"DstJobid",
-		"SrcCluster",
-		"DstCluster",
-		"SubmitTime",
+	solvers := newSolverMapper(config)
+	logger.Debug("LSFJobCollector: Loaded solver mappings", "count", len(solvers.mapping))
+
+	if err := validateJobsConfig(config.Jobs); err != nil {
+		return nil, err
+	}
+	perJob := config.Jobs.PerJob == nil || *config.Jobs.PerJob
+	aggregateBy := config.Jobs.AggregateBy
+	if len(aggregateBy) == 0 {
+		aggregateBy = defaultAggregateBy
+	}
+
+	pendingBuckets := make([]float64, 0, len(defaultPendingTimeBuckets))
+	buckets := config.Jobs.PendingTimeBuckets
+	if len(buckets) == 0 {
+		buckets = defaultPendingTimeBuckets
+	}
+	for _, b := range buckets {
+		pendingBuckets = append(pendingBuckets, b.Seconds())
+	}
+
+	fields := config.Jobs.Labels
+	if len(fields) == 0 {
+		fields = defaultJobLabelFields
+	}
+	labels := make([]jobLabel, len(fields))
+	labelsName := make([]string, len(fields))
+	for i, f := range fields {
+		labels[i] = jobLabelFields[f]
+		labelsName[i] = labels[i].name
+	}
+
+	usage := make([]*prometheus.Desc, len(jobUsages))
+	usageSum := make([]*prometheus.Desc, len(jobUsages))
+	for i, u := range jobUsages {
+		usage[i] = prometheus.NewDesc(prometheus.BuildFQName(namespace, "bjobs", u.name), u.help, labelsName, nil)
+		if u.sumHelp != "" {
+			usageSum[i] = prometheus.NewDesc(prometheus.BuildFQName(namespace, "jobs", u.name), u.sumHelp, []string{"queue", "user", "project"}, nil)
+		}
 	}
 
 	return &JobCollector{
@@ -121,15 +316,159 @@ func NewLSFJobCollector(logger *slog.Logger, config *config.Configuration) (Coll
 			nil,
 		),
 
-		logger:    logger,
-		solverMap: solverMap,
+		JobStates: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "jobs"),
+			"Number of unfinished jobs by state (PEND, RUN, PSUSP, USUSP, SSUSP, WAIT, ZOMBI or UNKWN).",
+			[]string{"state", "queue", "user", "project", "solver"},
+			nil,
+		),
+
+		PendingTimeHistogram: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "jobs", "pending_time_seconds"),
+			"Histogram of the time pending jobs have been waiting since submission (PEND_TIME).",
+			[]string{"queue", "solver"},
+			nil,
+		),
+
+		EligiblePendingTimeHistogram: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "jobs", "eligible_pending_time_seconds"),
+			"Histogram of the time pending jobs have been eligible for scheduling (EPENDTIME).",
+			[]string{"queue", "solver"},
+			nil,
+		),
+
+		IneligiblePendingTimeHistogram: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "jobs", "ineligible_pending_time_seconds"),
+			"Histogram of the time pending jobs have been ineligible for scheduling (IPENDTIME).",
+			[]string{"queue", "solver"},
+			nil,
+		),
+
+		Usage:    usage,
+		UsageSum: usageSum,
+
+		RequestedMem: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bjobs", "requested_mem_bytes"),
+			"Memory reserved by the job with rusage[mem=...].",
+			labelsName,
+			nil,
+		),
+
+		CPUEfficiency: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bjobs", "cpu_efficiency_ratio"),
+			"CPU time of the running job divided by its run time times its allocated slots.",
+			labelsName,
+			nil,
+		),
+
+		MemEfficiency: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bjobs", "mem_efficiency_ratio"),
+			"Peak memory of the running job divided by the memory it reserved.",
+			labelsName,
+			nil,
+		),
+
+		GroupCPUEfficiency: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "jobs", "cpu_efficiency_ratio"),
+			"CPU time of the running jobs divided by their run time times their allocated slots.",
+			[]string{"user", "project", "solver"},
+			nil,
+		),
+
+		GroupMemEfficiency: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "jobs", "mem_efficiency_ratio"),
+			"Peak memory of the running jobs divided by the memory they reserved.",
+			[]string{"user", "project", "solver"},
+			nil,
+		),
+
+		GroupJobs: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bjobs_group", "jobs"),
+			"Number of unfinished jobs.",
+			aggregateBy,
+			nil,
+		),
+
+		GroupSlots: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bjobs_group", "slots"),
+			"Number of slots allocated to unfinished jobs.",
+			aggregateBy,
+			nil,
+		),
+
+		GroupRequestedSlots: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bjobs_group", "requested_slots"),
+			"Number of processors requested by unfinished jobs.",
+			aggregateBy,
+			nil,
+		),
+
+		GroupPendingTime: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bjobs_group", "pending_time_seconds"),
+			"Summary of the time pending jobs have been waiting since submission.",
+			aggregateBy,
+			nil,
+		),
+
+		GroupPendingTimeMax: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bjobs_group", "pending_time_max_seconds"),
+			"Longest time a pending job has been waiting since submission.",
+			aggregateBy,
+			nil,
+		),
+
+		ArrayElements: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "job_array", "elements"),
+			"Number of elements of the job array in each state.",
+			[]string{"job_id", "job_name", "user", "state"},
+			nil,
+		),
+
+		ArrayProgress: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "job_array", "progress_ratio"),
+			"Share of the elements of the job array that are done or exited.",
+			[]string{"job_id", "job_name", "user"},
+			nil,
+		),
+
+		DependencyBlocked: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "jobs", "dependency_blocked"),
+			"Number of pending jobs waiting for their dependency condition.",
+			[]string{"queue", "job_group"},
+			nil,
+		),
+
+		DependencyNever: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "jobs", "dependency_unsatisfiable"),
+			"Number of pending jobs whose dependency condition can never be satisfied.",
+			[]string{"queue", "job_group"},
+			nil,
+		),
+
+		DependencyDepth: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "jobs", "dependency_chain_depth"),
+			"Longest chain of unfinished jobs waiting for one another in the job group.",
+			[]string{"job_group"},
+			nil,
+		),
+
+		logger:           logger,
+		runner:           newCommandRunner(logger, config),
+		solvers:          solvers,
+		perJob:           perJob,
+		labels:           labels,
+		aggregate:        config.Jobs.Aggregate,
+		aggregateBy:      aggregateBy,
+		pendingBuckets:   pendingBuckets,
+		rusageMemPerSlot: config.Jobs.RusageMemPerSlot,
+		collapseArrays:   config.Jobs.CollapseArrays,
 	}, nil
 }
 
 // Update calls c.getJobStatus to get the job info
 // memory metrics.
-func (c *JobCollector) Update(ch chan<- prometheus.Metric) error {
-	err := c.getJobStatus(ch)
+func (c *JobCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	err := c.getJobStatus(ctx, ch)
 	if err != nil {
 		return fmt.Errorf("couldn't get job infomation: %w", err)
 	}
@@ -148,6 +487,8 @@ func parseJobStatus(jobJson bjobsInfo) Job {
 	//}
 	//ts = ts.AddDate(time.Now().Year(), 0, 0)
 
+	arrayID, arrayIndex, _ := parseArrayJobID(jobJson.JOBID, jobJson.JOBINDEX)
+
 	return Job{
 		ID:            jobJson.JOBID,
 		User:          jobJson.USER,
@@ -174,6 +515,17 @@ func parseJobStatus(jobJson bjobsInfo) Job {
 		SrcCluster:    jobJson.SRCCLUSTER,
 		DstCluster:    jobJson.DSTCLUSTER,
 		SubmitTime:    jobJson.SUBMIT_TIME, //int64(ts.Unix()),
+		Mem:           jobJson.MEM,
+		MaxMem:        jobJson.MAX_MEM,
+		AvgMem:        jobJson.AVG_MEM,
+		Swap:          jobJson.SWAP,
+		CPUUsed:       jobJson.CPU_USED,
+		RunTime:       jobJson.RUN_TIME,
+		MemLimit:      jobJson.MEMLIMIT,
+		RunTimeLimit:  jobJson.RUNTIMELIMIT,
+		ResReq:        jobJson.EFFECTIVE_RESREQ,
+		ArrayID:       arrayID,
+		ArrayIndex:    arrayIndex,
 	}
 }
 
@@ -191,13 +543,22 @@ func bjobs_JsontoStruct(lsfOutput []byte, logger *slog.Logger) ([]bjobsInfo, err
 	//err := json.Unmarshal(lsfOutput, &bjobsInfos)
 	err := json.Unmarshal(lsfOutput, lsfAnswer)
 	if err != nil {
-		logger.Error("Error unmarshalling JSON", "err", err)
-		return nil, nil
+		return nil, fmt.Errorf("error unmarshalling JSON: %w", err)
 	}
 	//fmt.Printf("%+v\n", lsfAnswer.JOBS)
 	//fmt.Printf("%+v\n", lsfAnswer.RECORDS)
 
-	return lsfAnswer.RECORDS, nil
+	// Records for jobs that could not be shown only carry an ERROR message.
+	records := lsfAnswer.RECORDS[:0]
+	for _, r := range lsfAnswer.RECORDS {
+		if r.ERROR != "" {
+			logger.Debug("Skipping bjobs error record", "error", r.ERROR)
+			continue
+		}
+		records = append(records, r)
+	}
+
+	return records, nil
 }
 
 func bjobs_CsvtoStruct(lsfOutput []byte, logger *slog.Logger) ([]bjobsInfo, error) {
@@ -207,9 +568,10 @@ func bjobs_CsvtoStruct(lsfOutput []byte, logger *slog.Logger) ([]bjobsInfo, erro
 	csv_out.TrimLeadingSpace = true
 
 	dec, err := csvutil.NewDecoder(csv_out)
-	if err != nil {
-		logger.Error("Error decoding CSV", "err", err)
+	if err == io.EOF {
 		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error decoding CSV header: %w", err)
 	}
 
 	var bjobsInfos []bjobsInfo
@@ -226,13 +588,15 @@ func bjobs_CsvtoStruct(lsfOutput []byte, logger *slog.Logger) ([]bjobsInfo, erro
 
 }
 
-func (c *JobCollector) getJobStatus(ch chan<- prometheus.Metric) error {
+func (c *JobCollector) getJobStatus(ctx context.Context, ch chan<- prometheus.Metric) error {
 	//output, err := lsfOutput(c.logger, "bjobs", "-w", "-u", "all")
-	output, err := lsfOutput(c.logger, "bjobs", "-X", "-u", "all", "-o",
-		"JOBID USER STAT QUEUE FROM_HOST EXEC_HOST JOB_NAME SUBMIT_TIME UGROUP PROJECT APPLICATION JOB_GROUP DEPENDENCY NALLOC_SLOT MIN_REQ_PROC START_TIME SUB_CWD PEND_TIME EPENDTIME IPENDTIME SRCJOBID DSTJOBID SRCLUSTER FWD_CLUSTER", "-json")
-	if err != nil {
-		c.logger.Error("Failed to get bjobs output", "err", err, "output", string(output))
+	output, err := c.runner.Run(ctx, "bjobs", "-X", "-u", "all", "-o",
+		"JOBID JOBINDEX USER STAT QUEUE FROM_HOST EXEC_HOST JOB_NAME SUBMIT_TIME UGROUP PROJECT APPLICATION JOB_GROUP DEPENDENCY NALLOC_SLOT MIN_REQ_PROC START_TIME SUB_CWD PEND_TIME EPENDTIME IPENDTIME SRCJOBID DSTJOBID SRCLUSTER FWD_CLUSTER MEM MAX_MEM AVG_MEM SWAP CPU_USED RUN_TIME MEMLIMIT RUNTIMELIMIT EFFECTIVE_RESREQ", "-json")
+	if isErrorKind(err, ErrorKindNoJobs) {
+		c.logger.Debug("No unfinished job found")
 		return nil
+	} else if err != nil {
+		return err
 	}
 	//fmt.Printf("%+s", output)
 	//level.Info(c.logger).Log("err=", err, output)
@@ -240,59 +604,29 @@ func (c *JobCollector) getJobStatus(ch chan<- prometheus.Metric) error {
 	//jobs, err := bjobs_CsvtoStruct(output, c.logger)
 	jobs, err := bjobs_JsontoStruct(output, c.logger)
 	if err != nil {
-		c.logger.Error("Failed to parse bjobs output", "err", err)
-		return nil
+		return newParseError("lsfjob", "bjobs", err)
 	}
 	//fmt.Printf("%+v\n", jobs)
 	//fmt.Printf("%+v\n", len(jobs))
 
+	parsed := make([]Job, 0, len(jobs))
 	for _, j := range jobs {
 		jobStatus := parseJobStatus(j)
 
-		var solverName string
-		if jobStatus.Application != "" {
-			solverName = jobStatus.Application
-		} else {
-			solverName = jobStatus.Queue
-		}
+		jobStatus.Solver = c.solvers.solver(jobStatus.Application, jobStatus.Queue)
 		c.logger.Debug("LSFJobCollector",
 			"application", jobStatus.Application,
 			"queue", jobStatus.Queue,
-			"solver_name", solverName)
-		standardizedSolver := c.solverMap[strings.ToLower(solverName)]
-		if standardizedSolver == "" {
-			standardizedSolver = "unknown"
+			"standardized_solver", jobStatus.Solver)
+		parsed = append(parsed, jobStatus)
+
+		if !c.perJob || (c.collapseArrays && jobStatus.ArrayID != "") {
+			continue
 		}
-		c.logger.Debug("LSFJobCollector",
-			"standardized_solver", standardizedSolver)
-		jobStatus.Solver = standardizedSolver
-
-		labelsValue := []string{
-			jobStatus.ID,
-			jobStatus.User,
-			jobStatus.Status,
-			jobStatus.Queue,
-			jobStatus.FromHost,
-			jobStatus.ExecutionHost,
-			jobStatus.JobName,
-			jobStatus.UserGroup,
-			jobStatus.Project,
-			jobStatus.Application,
-			jobStatus.Solver,
-			jobStatus.JGroup,
-			jobStatus.Dependency,
-			jobStatus.NSlot,
-			jobStatus.NProc,
-			jobStatus.StartTime,
-			jobStatus.SubCWD,
-			jobStatus.PendTime,
-			jobStatus.EPendTime,
-			jobStatus.IPendTime,
-			jobStatus.SrcJobid,
-			jobStatus.DstJobid,
-			jobStatus.SrcCluster,
-			jobStatus.DstCluster,
-			jobStatus.SubmitTime,
+
+		labelsValue := make([]string, len(c.labels))
+		for i, l := range c.labels {
+			labelsValue[i] = l.value(&jobStatus)
 		}
 
 		nCPU, _ := strconv.ParseFloat(jobStatus.NProc, 64)
@@ -301,22 +635,313 @@ func (c *JobCollector) getJobStatus(ch chan<- prometheus.Metric) error {
 		)
 
 		pTime, _ := strconv.ParseFloat(jobStatus.PendTime, 64)
-		ch <- prometheus.MustNewConstMetric(c.JobInfoPendingTime, prometheus.CounterValue, pTime,
+		ch <- prometheus.MustNewConstMetric(c.JobInfoPendingTime, prometheus.GaugeValue, pTime,
 			labelsValue...,
 		)
 
 		epTime, _ := strconv.ParseFloat(jobStatus.EPendTime, 64)
-		ch <- prometheus.MustNewConstMetric(c.JobInfoEPendingTime, prometheus.CounterValue, epTime,
+		ch <- prometheus.MustNewConstMetric(c.JobInfoEPendingTime, prometheus.GaugeValue, epTime,
 			labelsValue...,
 		)
 
 		ipTime, _ := strconv.ParseFloat(jobStatus.IPendTime, 64)
-		ch <- prometheus.MustNewConstMetric(c.JobInfoIPendingTime, prometheus.CounterValue, ipTime,
+		ch <- prometheus.MustNewConstMetric(c.JobInfoIPendingTime, prometheus.GaugeValue, ipTime,
 			labelsValue...,
 		)
 
+		for i, u := range jobUsages {
+			if v, ok := u.value(&jobStatus); ok {
+				ch <- prometheus.MustNewConstMetric(c.Usage[i], prometheus.GaugeValue, v, labelsValue...)
+			}
+		}
+
+		if reqMem, ok := c.requestedMem(&jobStatus); ok {
+			ch <- prometheus.MustNewConstMetric(c.RequestedMem, prometheus.GaugeValue, reqMem, labelsValue...)
+		}
+		if cpu, capacity, ok := jobCPUWork(&jobStatus); ok {
+			ch <- prometheus.MustNewConstMetric(c.CPUEfficiency, prometheus.GaugeValue, cpu/capacity, labelsValue...)
+		}
+		if maxMem, reqMem, ok := c.jobMemWork(&jobStatus); ok {
+			ch <- prometheus.MustNewConstMetric(c.MemEfficiency, prometheus.GaugeValue, maxMem/reqMem, labelsValue...)
+		}
+
 	}
 
+	c.collectStates(ch, parsed)
+	c.collectPendingTimes(ch, parsed)
+	c.collectUsageSums(ch, parsed)
+	c.collectEfficiency(ch, parsed)
+	if c.aggregate {
+		c.collectAggregated(ch, parsed)
+	}
+	c.collectArrays(ctx, ch, parsed)
+	c.collectDependencies(ctx, ch, parsed)
+
 	return nil
 
 }
+
+// collectStates sends the number of jobs in each state, per queue, user,
+// project and solver.
+func (c *JobCollector) collectStates(ch chan<- prometheus.Metric, jobs []Job) {
+	type key struct{ state, queue, user, project, solver string }
+	counts := map[key]float64{}
+	keys := []key{}
+	for _, j := range jobs {
+		k := key{j.Status, j.Queue, j.User, j.Project, j.Solver}
+		if _, ok := counts[k]; !ok {
+			keys = append(keys, k)
+		}
+		counts[k]++
+	}
+	for _, k := range keys {
+		ch <- prometheus.MustNewConstMetric(c.JobStates, prometheus.GaugeValue, counts[k], k.state, k.queue, k.user, k.project, k.solver)
+	}
+}
+
+// collectUsageSums sends the resource usage of the jobs summed per queue,
+// user and project. Jobs without a value, such as pending jobs, are skipped.
+func (c *JobCollector) collectUsageSums(ch chan<- prometheus.Metric, jobs []Job) {
+	type key struct{ queue, user, project string }
+	sums := map[key][]float64{}
+	seen := map[key][]bool{}
+	keys := []key{}
+	for i := range jobs {
+		j := &jobs[i]
+		k := key{j.Queue, j.User, j.Project}
+		for u, usage := range jobUsages {
+			if c.UsageSum[u] == nil {
+				continue
+			}
+			v, ok := usage.value(j)
+			if !ok {
+				continue
+			}
+			if _, found := sums[k]; !found {
+				sums[k] = make([]float64, len(jobUsages))
+				seen[k] = make([]bool, len(jobUsages))
+				keys = append(keys, k)
+			}
+			sums[k][u] += v
+			seen[k][u] = true
+		}
+	}
+
+	for _, k := range keys {
+		for u := range jobUsages {
+			if seen[k][u] {
+				ch <- prometheus.MustNewConstMetric(c.UsageSum[u], prometheus.GaugeValue, sums[k][u], k.queue, k.user, k.project)
+			}
+		}
+	}
+}
+
+// requestedMem returns the memory reserved by j with rusage[mem=...], for
+// all its slots.
+func (c *JobCollector) requestedMem(j *Job) (float64, bool) {
+	mem, ok := parseRusageMem(j.ResReq)
+	if !ok {
+		return 0, false
+	}
+	if c.rusageMemPerSlot {
+		slots, err := strconv.ParseFloat(j.NSlot, 64)
+		if err != nil || slots <= 0 {
+			return 0, false
+		}
+		mem *= slots
+	}
+	return mem, true
+}
+
+// jobCPUWork returns the CPU time used by the running job j and the CPU
+// time its slots could have used since it started.
+func jobCPUWork(j *Job) (float64, float64, bool) {
+	if j.Status != "RUN" {
+		return 0, 0, false
+	}
+	cpu, ok := parseLSFDuration(j.CPUUsed, 1)
+	if !ok {
+		return 0, 0, false
+	}
+	run, ok := parseLSFDuration(j.RunTime, 1)
+	slots, err := strconv.ParseFloat(j.NSlot, 64)
+	if !ok || err != nil || run <= 0 || slots <= 0 {
+		return 0, 0, false
+	}
+	return cpu, run * slots, true
+}
+
+// jobMemWork returns the peak memory of the running job j and the memory it
+// reserved.
+func (c *JobCollector) jobMemWork(j *Job) (float64, float64, bool) {
+	if j.Status != "RUN" {
+		return 0, 0, false
+	}
+	maxMem, ok := parseLSFMemory(j.MaxMem)
+	if !ok {
+		return 0, 0, false
+	}
+	reqMem, ok := c.requestedMem(j)
+	if !ok || reqMem <= 0 {
+		return 0, 0, false
+	}
+	return maxMem, reqMem, true
+}
+
+// collectEfficiency sends the CPU and memory efficiency of the running jobs
+// per user, project and solver, as the ratio of their sums.
+func (c *JobCollector) collectEfficiency(ch chan<- prometheus.Metric, jobs []Job) {
+	type key struct{ user, project, solver string }
+	type work struct{ cpu, capacity, maxMem, reqMem float64 }
+	groups := map[key]*work{}
+	keys := []key{}
+	for i := range jobs {
+		j := &jobs[i]
+		cpu, capacity, cpuOK := jobCPUWork(j)
+		maxMem, reqMem, memOK := c.jobMemWork(j)
+		if !cpuOK && !memOK {
+			continue
+		}
+		k := key{j.User, j.Project, j.Solver}
+		g, ok := groups[k]
+		if !ok {
+			g = &work{}
+			groups[k] = g
+			keys = append(keys, k)
+		}
+		if cpuOK {
+			g.cpu += cpu
+			g.capacity += capacity
+		}
+		if memOK {
+			g.maxMem += maxMem
+			g.reqMem += reqMem
+		}
+	}
+
+	for _, k := range keys {
+		g := groups[k]
+		if g.capacity > 0 {
+			ch <- prometheus.MustNewConstMetric(c.GroupCPUEfficiency, prometheus.GaugeValue, g.cpu/g.capacity, k.user, k.project, k.solver)
+		}
+		if g.reqMem > 0 {
+			ch <- prometheus.MustNewConstMetric(c.GroupMemEfficiency, prometheus.GaugeValue, g.maxMem/g.reqMem, k.user, k.project, k.solver)
+		}
+	}
+}
+
+// histogram accumulates the observations of a const histogram.
+type histogram struct {
+	count   uint64
+	sum     float64
+	buckets map[float64]uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	h := &histogram{buckets: make(map[float64]uint64, len(buckets))}
+	for _, b := range buckets {
+		h.buckets[b] = 0
+	}
+	return h
+}
+
+func (h *histogram) observe(v float64) {
+	h.count++
+	h.sum += v
+	for b := range h.buckets {
+		if v <= b {
+			h.buckets[b]++
+		}
+	}
+}
+
+// collectPendingTimes sends the histograms of the pending, eligible and
+// ineligible pending times of the pending jobs, per queue and solver.
+func (c *JobCollector) collectPendingTimes(ch chan<- prometheus.Metric, jobs []Job) {
+	type key struct{ queue, solver string }
+	type times struct{ pending, eligible, ineligible *histogram }
+	groups := map[key]*times{}
+	keys := []key{}
+	for _, j := range jobs {
+		if j.Status != "PEND" {
+			continue
+		}
+		k := key{j.Queue, j.Solver}
+		g, ok := groups[k]
+		if !ok {
+			g = &times{newHistogram(c.pendingBuckets), newHistogram(c.pendingBuckets), newHistogram(c.pendingBuckets)}
+			groups[k] = g
+			keys = append(keys, k)
+		}
+		pTime, _ := strconv.ParseFloat(j.PendTime, 64)
+		g.pending.observe(pTime)
+		epTime, _ := strconv.ParseFloat(j.EPendTime, 64)
+		g.eligible.observe(epTime)
+		ipTime, _ := strconv.ParseFloat(j.IPendTime, 64)
+		g.ineligible.observe(ipTime)
+	}
+
+	for _, k := range keys {
+		g := groups[k]
+		ch <- prometheus.MustNewConstHistogram(c.PendingTimeHistogram, g.pending.count, g.pending.sum, g.pending.buckets, k.queue, k.solver)
+		ch <- prometheus.MustNewConstHistogram(c.EligiblePendingTimeHistogram, g.eligible.count, g.eligible.sum, g.eligible.buckets, k.queue, k.solver)
+		ch <- prometheus.MustNewConstHistogram(c.IneligiblePendingTimeHistogram, g.ineligible.count, g.ineligible.sum, g.ineligible.buckets, k.queue, k.solver)
+	}
+}
+
+// jobAggregate sums up the jobs sharing the same aggregation labels.
+type jobAggregate struct {
+	labels         []string
+	jobs           float64
+	slots          float64
+	requestedSlots float64
+	pending        uint64
+	pendingSum     float64
+	pendingMax     float64
+}
+
+// collectAggregated sends the job counts, slot sums and pending time
+// summaries of jobs, grouped by c.aggregateBy.
+func (c *JobCollector) collectAggregated(ch chan<- prometheus.Metric, jobs []Job) {
+	groups := map[string]*jobAggregate{}
+	keys := []string{}
+	for i := range jobs {
+		j := &jobs[i]
+		labels := make([]string, len(c.aggregateBy))
+		for k, l := range c.aggregateBy {
+			labels[k] = jobLabels[l](j)
+		}
+		key := strings.Join(labels, "\xff")
+		g, ok := groups[key]
+		if !ok {
+			g = &jobAggregate{labels: labels}
+			groups[key] = g
+			keys = append(keys, key)
+		}
+
+		g.jobs++
+		nSlot, _ := strconv.ParseFloat(j.NSlot, 64)
+		g.slots += nSlot
+		nProc, _ := strconv.ParseFloat(j.NProc, 64)
+		g.requestedSlots += nProc
+		if j.Status == "PEND" {
+			pTime, _ := strconv.ParseFloat(j.PendTime, 64)
+			g.pending++
+			g.pendingSum += pTime
+			if pTime > g.pendingMax {
+				g.pendingMax = pTime
+			}
+		}
+	}
+
+	for _, key := range keys {
+		g := groups[key]
+		ch <- prometheus.MustNewConstMetric(c.GroupJobs, prometheus.GaugeValue, g.jobs, g.labels...)
+		ch <- prometheus.MustNewConstMetric(c.GroupSlots, prometheus.GaugeValue, g.slots, g.labels...)
+		ch <- prometheus.MustNewConstMetric(c.GroupRequestedSlots, prometheus.GaugeValue, g.requestedSlots, g.labels...)
+		if g.pending > 0 {
+			ch <- prometheus.MustNewConstSummary(c.GroupPendingTime, g.pending, g.pendingSum, nil, g.labels...)
+			ch <- prometheus.MustNewConstMetric(c.GroupPendingTimeMax, prometheus.GaugeValue, g.pendingMax, g.labels...)
+		}
+	}
+}
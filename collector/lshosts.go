@@ -2,6 +2,7 @@ package collector
 
 import (
 	"bytes"
+	"context"
 	"encoding/csv"
 	"fmt"
 	"io"
@@ -21,6 +22,7 @@ type lshostsCollector struct {
 	HostNCpus  *prometheus.Desc
 	HostCpuf   *prometheus.Desc
 	logger     *slog.Logger
+	runner     config.CommandRunner
 }
 
 func init() {
@@ -52,18 +54,19 @@ func NewLSFlshostCollector(logger *slog.Logger, config *config.Configuration) (C
 			[]string{"host_name", "host_type", "host_model", "server_type", "resource_type"}, nil,
 		),
 		logger: logger,
+		runner: newCommandRunner(logger, config),
 	}, nil
 }
 
 // Update calls (*lmstatCollector).getLmStat to get the platform specific
 // memory metrics.
-func (c *lshostsCollector) Update(ch chan<- prometheus.Metric) error {
+func (c *lshostsCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	// err := c.getLmstatInfo(ch)
 	// if err != nil {
 	//  return fmt.Errorf("couldn't get lmstat version information: %w", err)
 	// }
 
-	err := c.parselshostsCount(ch)
+	err := c.parselshostsCount(ctx, ch)
 
 	if err != nil {
 		return fmt.Errorf("couldn't get bhosts infomation: %w", err)
@@ -80,9 +83,10 @@ func lshosts_CsvtoStruct(lsfOutput []byte, logger *slog.Logger) ([]lshostsInfo,
 	csv_out.FieldsPerRecord = -1 // Allow different record length (resources)
 
 	dec, err := csvutil.NewDecoder(csv_out)
-	if err != nil {
-		logger.Error("Error decoding CSV", "err", err)
+	if err == io.EOF {
 		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error decoding CSV header: %w", err)
 	}
 
 	var lshostsInfos []lshostsInfo
@@ -97,6 +101,7 @@ func lshosts_CsvtoStruct(lsfOutput []byte, logger *slog.Logger) ([]lshostsInfo,
 			//            continue
 		} else if err != nil {
 			logger.Error("Error decoding record", "err", err)
+			parseErrorsTotal.WithLabelValues("lshosts").Inc()
 			//            return nil, nil
 		}
 
@@ -147,17 +152,15 @@ func ConvertresourceType(resource_type string) string {
 	return resource_type_new
 }
 
-func (c *lshostsCollector) parselshostsCount(ch chan<- prometheus.Metric) error {
+func (c *lshostsCollector) parselshostsCount(ctx context.Context, ch chan<- prometheus.Metric) error {
 	//    output, err := lsfOutput(c.logger, "lshosts", "-w")
-	output, err := lsfOutput(c.logger, "lshosts", "-o", "HOST_NAME type model cpuf ncpus maxmem maxswp  server nprocs ncores nthreads RESOURCES")
+	output, err := c.runner.Run(ctx, "lshosts", "-o", "HOST_NAME type model cpuf ncpus maxmem maxswp  server nprocs ncores nthreads RESOURCES")
 	if err != nil {
-		c.logger.Error("Failed to get lshosts output", "err", err)
-		return nil
+		return err
 	}
 	lshosts, err := lshosts_CsvtoStruct(output, c.logger)
 	if err != nil {
-		c.logger.Error("Failed to parse lshosts output", "err", err)
-		return nil
+		return newParseError("lshosts", "lshosts", err)
 	}
 
 	for _, lshost := range lshosts {
@@ -2,6 +2,7 @@ package collector
 
 import (
 	"bytes"
+	"context"
 	"encoding/csv"
 	"fmt"
 	"io"
@@ -23,6 +24,7 @@ type lsLoadCollector struct {
 	LsLoadls         *prometheus.Desc
 	LsLoadHostStatus *prometheus.Desc
 	logger           *slog.Logger
+	runner           config.CommandRunner
 }
 
 func init() {
@@ -64,18 +66,19 @@ func NewLSFlsLoadCollector(logger *slog.Logger, config *config.Configuration) (C
 			[]string{"host_name"}, nil,
 		),
 		logger: logger,
+		runner: newCommandRunner(logger, config),
 	}, nil
 }
 
 // Update calls (*lmstatCollector).getLmStat to get the platform specific
 // memory metrics.
-func (c *lsLoadCollector) Update(ch chan<- prometheus.Metric) error {
+func (c *lsLoadCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	// err := c.getLmstatInfo(ch)
 	// if err != nil {
 	// 	return fmt.Errorf("couldn't get lmstat version information: %w", err)
 	// }
 
-	err := c.parselsLoad(ch)
+	err := c.parselsLoad(ctx, ch)
 
 	if err != nil {
 		return fmt.Errorf("couldn't get bhosts infomation: %w", err)
@@ -91,9 +94,10 @@ func lsload_CsvtoStruct(lsfOutput []byte, logger *slog.Logger) ([]lsloadInfo, er
 	csv_out.TrimLeadingSpace = true
 
 	dec, err := csvutil.NewDecoder(csv_out)
-	if err != nil {
-		logger.Error("Error decoding CSV", "err", err)
+	if err == io.EOF {
 		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error decoding CSV header: %w", err)
 	}
 
 	var lsloadInfos []lsloadInfo
@@ -108,6 +112,7 @@ func lsload_CsvtoStruct(lsfOutput []byte, logger *slog.Logger) ([]lsloadInfo, er
 			}
 			recinfo := dec.Record()[0] + " " + dec.Record()[1]
 			logger.Error("Error decoding record", "recinfo", recinfo, "err", err)
+			parseErrorsTotal.WithLabelValues("lsload").Inc()
 			//			return nil, nil
 		}
 
@@ -149,16 +154,14 @@ func ConvertUT(data string, logger *slog.Logger) float64 {
 	return fl
 }
 
-func (c *lsLoadCollector) parselsLoad(ch chan<- prometheus.Metric) error {
-	output, err := lsfOutput(c.logger, "lsload", "-w")
+func (c *lsLoadCollector) parselsLoad(ctx context.Context, ch chan<- prometheus.Metric) error {
+	output, err := c.runner.Run(ctx, "lsload", "-w")
 	if err != nil {
-		c.logger.Error("Failed to get lsload output", "err", err)
-		return nil
+		return err
 	}
 	lsloads, err := lsload_CsvtoStruct(output, c.logger)
 	if err != nil {
-		c.logger.Error("Failed to parse lsload output", "err", err)
-		return nil
+		return newParseError("lsload", "lsload", err)
 	}
 
 	for _, lsload := range lsloads {
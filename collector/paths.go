@@ -14,10 +14,325 @@
 
 package collector
 
-// The path of the Flexlm binaries.
-// var (
-// 	LSF_BINDIR    = kingpin.Flag("lsf_path.lsf_bindir", "LSF BIN DIR PATH.").Envar("LSF_BINDIR").Required().String()
-// 	LSF_SERVERDIR = kingpin.Flag("lsf_path.serverdir", "LSF SERVER DIR PATH.").Envar("LSF_SERVERDIR").Required().String()
-// 	LSF_ENVDIR    = kingpin.Flag("lsf_path.envdir", "LSF ENV DIR PATH.").Envar("LSF_ENVDIR").Required().String()
-// 	LSF_LIBDIR    = kingpin.Flag("lsf_path.libdir", "LSF LIB DIR PATH.").Envar("LSF_LIBDIR").Required().String()
-// )
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"lsf_exporter/config"
+)
+
+// collectorCommands lists the LSF commands run by each collector, so that
+// they can be checked at startup.
+var collectorCommands = map[string][]string{
+	"bhosts":          {"bhosts"},
+	"bjgroup":         {"bjgroup"},
+	"bqueues":         {"bqueues"},
+	"busers":          {"bugroup", "busers"},
+	"exited_jobs":     {"bjobs"},
+	"fairshare":       {"bhpart", "bqueues"},
+	"lsf_information": {"lsid"},
+	"lsfjob":          {"bjobs"},
+	"lshosts":         {"lshosts"},
+	"lsload":          {"lsload"},
+	"pending_reason":  {"bjobs"},
+}
+
+// EnabledCommands returns the sorted LSF commands run by the enabled collectors.
+func EnabledCommands() []string {
+	seen := map[string]bool{}
+	commands := []string{}
+	for name, enabled := range collectorStates() {
+		if !enabled {
+			continue
+		}
+		for _, cmd := range collectorCommands[name] {
+			if !seen[cmd] {
+				seen[cmd] = true
+				commands = append(commands, cmd)
+			}
+		}
+	}
+	sort.Strings(commands)
+	return commands
+}
+
+// Environment holds the LSF directories and variables the LSF commands are
+// run with.
+type Environment struct {
+	BinDir    string
+	ServerDir string
+	EnvDir    string
+	LibDir    string
+	// Vars holds the other variables exported by profile.lsf.
+	Vars map[string]string
+}
+
+// LoadEnvironment resolves the LSF environment. Directories given in opts
+// win over the ones exported by the profile.lsf named in opts, which win
+// over the ones set in $LSF_ENVDIR/lsf.conf.
+func LoadEnvironment(opts config.CliOpts) (*Environment, error) {
+	env := &Environment{
+		BinDir:    opts.LsfBinDir,
+		ServerDir: opts.LsfServerDir,
+		EnvDir:    opts.LsfEnvDir,
+		LibDir:    opts.LsfLibDir,
+		Vars:      map[string]string{},
+	}
+
+	if opts.LsfProfile != "" {
+		vars, err := ParseProfile(opts.LsfProfile)
+		if err != nil {
+			return nil, err
+		}
+		env.merge(vars)
+	}
+
+	if env.EnvDir != "" && (env.BinDir == "" || env.ServerDir == "" || env.LibDir == "") {
+		lsfConf := filepath.Join(env.EnvDir, "lsf.conf")
+		if _, err := os.Stat(lsfConf); err == nil {
+			vars, err := parseAssignments(lsfConf, false)
+			if err != nil {
+				return nil, err
+			}
+			env.merge(vars)
+		}
+	}
+
+	return env, nil
+}
+
+// merge fills the directories still unset in e from vars, and records the
+// remaining variables.
+func (e *Environment) merge(vars map[string]string) {
+	for name, value := range vars {
+		switch name {
+		case "LSF_BINDIR":
+			setIfEmpty(&e.BinDir, value)
+		case "LSF_SERVERDIR":
+			setIfEmpty(&e.ServerDir, value)
+		case "LSF_ENVDIR":
+			setIfEmpty(&e.EnvDir, value)
+		case "LSF_LIBDIR":
+			setIfEmpty(&e.LibDir, value)
+		default:
+			if _, ok := e.Vars[name]; !ok {
+				e.Vars[name] = value
+			}
+		}
+	}
+}
+
+func setIfEmpty(dst *string, value string) {
+	if *dst == "" {
+		*dst = value
+	}
+}
+
+// Validate checks that the configured directories exist and that every
+// command is an executable file, and reports all the problems found.
+func (e *Environment) Validate(commands []string) error {
+	var errs []error
+
+	for _, d := range []struct{ name, path string }{
+		{"LSF_BINDIR", e.BinDir},
+		{"LSF_SERVERDIR", e.ServerDir},
+		{"LSF_ENVDIR", e.EnvDir},
+		{"LSF_LIBDIR", e.LibDir},
+	} {
+		if d.path == "" {
+			continue
+		}
+		if fi, err := os.Stat(d.path); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", d.name, err))
+		} else if !fi.IsDir() {
+			errs = append(errs, fmt.Errorf("%s: %s is not a directory", d.name, d.path))
+		}
+	}
+
+	if e.EnvDir != "" {
+		if _, err := os.Stat(filepath.Join(e.EnvDir, "lsf.conf")); err != nil {
+			errs = append(errs, fmt.Errorf("LSF_ENVDIR: %w", err))
+		}
+	} else if _, err := os.Stat("/etc/lsf.conf"); err != nil {
+		errs = append(errs, errors.New("LSF_ENVDIR is not set and /etc/lsf.conf does not exist"))
+	}
+
+	for _, cmd := range commands {
+		if _, err := e.LookPath(cmd); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// searchPath returns the directories searched for LSF commands: the
+// exporter's PATH, so that wrappers installed there take precedence, then
+// LSF_BINDIR.
+func (e *Environment) searchPath() []string {
+	dirs := filepath.SplitList(os.Getenv("PATH"))
+	if e.BinDir != "" {
+		dirs = append(dirs, e.BinDir)
+	}
+	return dirs
+}
+
+// LookPath returns the path of the executable file for an LSF command.
+func (e *Environment) LookPath(name string) (string, error) {
+	if strings.Contains(name, string(filepath.Separator)) {
+		if err := checkExecutable(name); err != nil {
+			return "", err
+		}
+		return name, nil
+	}
+	for _, dir := range e.searchPath() {
+		if dir == "" {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if checkExecutable(path) == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("LSF command %q not found in PATH or LSF_BINDIR (%q)", name, e.BinDir)
+}
+
+func checkExecutable(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() || fi.Mode().Perm()&0o111 == 0 {
+		return fmt.Errorf("%s is not an executable file", path)
+	}
+	return nil
+}
+
+// Environ returns the process environment for the LSF commands.
+func (e *Environment) Environ() []string {
+	vars := map[string]string{}
+	for name, value := range e.Vars {
+		vars[name] = value
+	}
+	for name, value := range map[string]string{
+		"LSF_BINDIR":    e.BinDir,
+		"LSF_SERVERDIR": e.ServerDir,
+		"LSF_ENVDIR":    e.EnvDir,
+		"LSF_LIBDIR":    e.LibDir,
+	} {
+		if value != "" {
+			vars[name] = value
+		}
+	}
+	vars["PATH"] = strings.Join(e.searchPath(), string(filepath.ListSeparator))
+
+	environ := []string{}
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if _, ok := vars[name]; !ok {
+			environ = append(environ, kv)
+		}
+	}
+	for name, value := range vars {
+		environ = append(environ, name+"="+value)
+	}
+	return environ
+}
+
+var (
+	assignmentRegex = regexp.MustCompile(`^(export\s+)?([A-Za-z_][A-Za-z0-9_]*)=(.*)$`)
+	exportRegex     = regexp.MustCompile(`^export\s+([A-Za-z_][A-Za-z0-9_ \t]*)$`)
+	variableRegex   = regexp.MustCompile(`\$\{?([A-Za-z_][A-Za-z0-9_]*)\}?`)
+)
+
+// ParseProfile returns the variables exported by an LSF profile.lsf. The
+// profile is not run: only literal assignments are understood, with $VAR
+// references to variables assigned earlier in the file.
+func ParseProfile(path string) (map[string]string, error) {
+	return parseAssignments(path, true)
+}
+
+// parseAssignments reads the NAME=value lines of a shell or lsf.conf file.
+// When exportedOnly is set, only the variables that are exported are
+// returned.
+func parseAssignments(path string, exportedOnly bool) (map[string]string, error) {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	defer file.Close()
+
+	assigned := map[string]string{}
+	exported := map[string]bool{}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		line = strings.TrimSuffix(line, ";")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if m := exportRegex.FindStringSubmatch(line); m != nil {
+			for _, name := range strings.Fields(m[1]) {
+				exported[name] = true
+			}
+			continue
+		}
+		m := assignmentRegex.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		value, ok := literalValue(m[3], assigned)
+		if !ok {
+			continue
+		}
+		assigned[m[2]] = value
+		if m[1] != "" {
+			exported[m[2]] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	if !exportedOnly {
+		return assigned, nil
+	}
+	vars := map[string]string{}
+	for name := range exported {
+		if value, ok := assigned[name]; ok {
+			vars[name] = value
+		}
+	}
+	return vars, nil
+}
+
+// literalValue unquotes a shell value and expands the references to known
+// variables. Values computed by commands are rejected.
+func literalValue(raw string, known map[string]string) (string, bool) {
+	value := strings.TrimSpace(raw)
+	if strings.ContainsAny(value, "`") || strings.Contains(value, "$(") {
+		return "", false
+	}
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		if value[0] == '\'' {
+			return value[1 : len(value)-1], true
+		}
+		value = value[1 : len(value)-1]
+	} else if i := strings.IndexAny(value, " \t"); i >= 0 {
+		value = value[:i]
+	}
+	return variableRegex.ReplaceAllStringFunc(value, func(ref string) string {
+		name := variableRegex.FindStringSubmatch(ref)[1]
+		if v, ok := known[name]; ok {
+			return v
+		}
+		return os.Getenv(name)
+	}), true
+}
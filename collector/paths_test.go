@@ -0,0 +1,163 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"lsf_exporter/config"
+)
+
+// writeFile writes content to name in dir and returns its path.
+func writeFile(t *testing.T, dir, name, content string, perm os.FileMode) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), perm); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseProfile(t *testing.T) {
+	profile := writeFile(t, t.TempDir(), "profile.lsf", `# LSF 10.1 profile
+LSF_ENVDIR=/opt/lsf/conf
+LSF_BINDIR="/opt/lsf/10.1/linux/bin"
+export LSF_SERVERDIR='/opt/lsf/10.1/linux/$etc'
+LSF_LIBDIR=${LSF_ENVDIR}/../lib
+export LSF_ENVDIR LSF_BINDIR LSF_LIBDIR;
+LSF_VERSION=`+"`cat /opt/lsf/version`"+`
+MACHINE=$(uname -m)
+export LSF_VERSION MACHINE
+NOT_EXPORTED=1
+`, 0o644)
+
+	vars, err := ParseProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"LSF_ENVDIR":    "/opt/lsf/conf",
+		"LSF_BINDIR":    "/opt/lsf/10.1/linux/bin",
+		"LSF_SERVERDIR": "/opt/lsf/10.1/linux/$etc",
+		"LSF_LIBDIR":    "/opt/lsf/conf/../lib",
+	}
+	if !reflect.DeepEqual(vars, expected) {
+		t.Errorf("expected %v, got %v", expected, vars)
+	}
+}
+
+func TestParseAssignments(t *testing.T) {
+	lsfConf := writeFile(t, t.TempDir(), "lsf.conf", `LSB_SHAREDIR=/shared/lsf/work
+LSF_LOGDIR="/var/log/lsf"
+LSF_TOP=/opt/lsf   # installation directory
+`, 0o644)
+
+	vars, err := parseAssignments(lsfConf, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"LSB_SHAREDIR": "/shared/lsf/work",
+		"LSF_LOGDIR":   "/var/log/lsf",
+		"LSF_TOP":      "/opt/lsf",
+	}
+	if !reflect.DeepEqual(vars, expected) {
+		t.Errorf("expected %v, got %v", expected, vars)
+	}
+
+	if _, err := parseAssignments(filepath.Join(t.TempDir(), "missing"), false); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestLoadEnvironmentPrecedence(t *testing.T) {
+	envDir := t.TempDir()
+	writeFile(t, envDir, "lsf.conf", `LSF_BINDIR=/conf/bin
+LSF_SERVERDIR=/conf/etc
+LSF_LIBDIR=/conf/lib
+LSF_LOGDIR=/conf/log
+`, 0o644)
+	profile := writeFile(t, t.TempDir(), "profile.lsf", `export LSF_ENVDIR=`+envDir+`
+export LSF_BINDIR=/profile/bin
+export LSF_SERVERDIR=/profile/etc
+export LSF_LOGDIR=/profile/log
+`, 0o644)
+
+	env, err := LoadEnvironment(config.CliOpts{LsfBinDir: "/flag/bin", LsfProfile: profile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []struct{ name, got, expected string }{
+		{"LSF_BINDIR", env.BinDir, "/flag/bin"},
+		{"LSF_SERVERDIR", env.ServerDir, "/profile/etc"},
+		{"LSF_LIBDIR", env.LibDir, "/conf/lib"},
+		{"LSF_ENVDIR", env.EnvDir, envDir},
+		{"LSF_LOGDIR", env.Vars["LSF_LOGDIR"], "/profile/log"},
+	} {
+		if d.got != d.expected {
+			t.Errorf("expected %s %q, got %q", d.name, d.expected, d.got)
+		}
+	}
+}
+
+func TestLookPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs POSIX file modes")
+	}
+
+	pathDir, binDir := t.TempDir(), t.TempDir()
+	t.Setenv("PATH", pathDir)
+	script := "#!/bin/sh\n"
+	writeFile(t, pathDir, "bjobs", script, 0o755)
+	writeFile(t, binDir, "bjobs", script, 0o755)
+	writeFile(t, pathDir, "bhosts", script, 0o644)
+	writeFile(t, binDir, "bhosts", script, 0o755)
+	env := &Environment{BinDir: binDir}
+
+	for _, c := range []struct{ name, expected string }{
+		// A wrapper in PATH takes precedence over LSF_BINDIR.
+		{"bjobs", filepath.Join(pathDir, "bjobs")},
+		// Files that are not executable are skipped.
+		{"bhosts", filepath.Join(binDir, "bhosts")},
+	} {
+		path, err := env.LookPath(c.name)
+		if err != nil || path != c.expected {
+			t.Errorf("expected %s at %s, got %q, %v", c.name, c.expected, path, err)
+		}
+	}
+
+	_, err := env.LookPath("bqueues")
+	if err == nil || !strings.Contains(err.Error(), `"bqueues" not found`) {
+		t.Errorf("expected bqueues not to be found, got %v", err)
+	}
+}
+
+func TestEnvironmentValidate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs POSIX file modes")
+	}
+
+	t.Setenv("PATH", "")
+	binDir, envDir := t.TempDir(), t.TempDir()
+	writeFile(t, binDir, "bjobs", "#!/bin/sh\n", 0o755)
+	writeFile(t, envDir, "lsf.conf", "LSF_TOP=/opt/lsf\n", 0o644)
+
+	env := &Environment{BinDir: binDir, EnvDir: envDir}
+	if err := env.Validate([]string{"bjobs"}); err != nil {
+		t.Errorf("expected a valid environment, got %v", err)
+	}
+
+	env.ServerDir = filepath.Join(envDir, "missing")
+	err := env.Validate([]string{"bjobs", "bhosts"})
+	if err == nil {
+		t.Fatal("expected an invalid environment")
+	}
+	for _, problem := range []string{"LSF_SERVERDIR", `"bhosts" not found`} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("expected %s to be reported, got %v", problem, err)
+		}
+	}
+}
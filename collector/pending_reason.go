@@ -0,0 +1,164 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"lsf_exporter/config"
+)
+
+// defaultPendingReasonsLimit is the number of distinct pending reasons
+// exported when jobs.pending_reasons_limit is not set.
+const defaultPendingReasonsLimit = 20
+
+// otherPendingReason is the reason of the jobs pending for a reason beyond
+// the limit.
+const otherPendingReason = "other"
+
+var (
+	// pendingReasonHostsRegex matches the number of hosts LSF appends to a
+	// reason, as in "Not enough job slot(s): 3 hosts".
+	pendingReasonHostsRegex = regexp.MustCompile(`:\s*\d+\s+hosts?$`)
+	// pendingReasonNumberRegex matches job IDs, counts and limits.
+	pendingReasonNumberRegex = regexp.MustCompile(`\b\d+(\.\d+)?\b`)
+	pendingReasonSpaceRegex  = regexp.MustCompile(`\s+`)
+)
+
+type pendingReasonCollector struct {
+	PendingReason *prometheus.Desc
+	logger        *slog.Logger
+	runner        config.CommandRunner
+	limit         int
+}
+
+func init() {
+	registerCollector("pending_reason", defaultDisabled, NewPendingReasonCollector)
+}
+
+// NewPendingReasonCollector returns a new Collector exposing the reasons
+// jobs are pending for.
+func NewPendingReasonCollector(logger *slog.Logger, config *config.Configuration) (Collector, error) {
+	limit := config.Jobs.PendingReasonsLimit
+	if limit == 0 {
+		limit = defaultPendingReasonsLimit
+	}
+
+	return &pendingReasonCollector{
+		PendingReason: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "jobs", "pending_reason"),
+			"Number of pending jobs per queue and pending reason. A job pending for several reasons is counted under each.",
+			[]string{"queue", "reason"}, nil,
+		),
+		logger: logger,
+		runner: newCommandRunner(logger, config),
+		limit:  limit,
+	}, nil
+}
+
+// Update calls c.parsePendingReasons to get the pending reasons of jobs.
+func (c *pendingReasonCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	err := c.parsePendingReasons(ctx, ch)
+	if err != nil {
+		return fmt.Errorf("couldn't get pending reasons: %w", err)
+	}
+
+	return nil
+}
+
+// normalizePendingReason strips the host counts, job IDs and other numbers
+// from a pending reason, so that the same reason is reported the same way
+// for every job.
+func normalizePendingReason(reason string) string {
+	reason = strings.TrimSpace(reason)
+	reason = pendingReasonHostsRegex.ReplaceAllString(reason, "")
+	reason = pendingReasonNumberRegex.ReplaceAllString(reason, "N")
+	reason = pendingReasonSpaceRegex.ReplaceAllString(reason, " ")
+	return strings.TrimRight(reason, " .;:")
+}
+
+// splitPendingReasons returns the normalized, distinct reasons of the
+// PEND_REASON field of a job, which lists them separated by ";" or newlines.
+func splitPendingReasons(field string) []string {
+	seen := map[string]bool{}
+	reasons := []string{}
+	for _, r := range strings.FieldsFunc(field, func(r rune) bool { return r == ';' || r == '\n' }) {
+		r = normalizePendingReason(r)
+		if r == "" || seen[r] {
+			continue
+		}
+		seen[r] = true
+		reasons = append(reasons, r)
+	}
+	return reasons
+}
+
+func (c *pendingReasonCollector) parsePendingReasons(ctx context.Context, ch chan<- prometheus.Metric) error {
+	output, err := c.runner.Run(ctx, "bjobs", "-u", "all", "-p", "-o", "JOBID QUEUE PEND_REASON", "-json")
+	if isErrorKind(err, ErrorKindNoJobs) {
+		c.logger.Debug("No pending job found")
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	jobs, err := bjobs_JsontoStruct(output, c.logger)
+	if err != nil {
+		return newParseError("pending_reason", "bjobs", err)
+	}
+
+	jobReasons := make([][]string, len(jobs))
+	totals := map[string]float64{}
+	for i, j := range jobs {
+		jobReasons[i] = splitPendingReasons(j.PEND_REASON)
+		for _, r := range jobReasons[i] {
+			totals[r]++
+		}
+	}
+
+	// Keep the most frequent reasons and count the others as "other".
+	reasons := make([]string, 0, len(totals))
+	for r := range totals {
+		reasons = append(reasons, r)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if totals[reasons[i]] != totals[reasons[j]] {
+			return totals[reasons[i]] > totals[reasons[j]]
+		}
+		return reasons[i] < reasons[j]
+	})
+	kept := map[string]bool{}
+	for i, r := range reasons {
+		if i < c.limit {
+			kept[r] = true
+		}
+	}
+	if len(reasons) > c.limit {
+		c.logger.Debug("Too many pending reasons, counting the rarest as other", "reasons", len(reasons), "limit", c.limit)
+	}
+
+	type key struct{ queue, reason string }
+	counts := map[key]float64{}
+	for i, j := range jobs {
+		counted := map[string]bool{}
+		for _, r := range jobReasons[i] {
+			if !kept[r] {
+				r = otherPendingReason
+			}
+			if !counted[r] {
+				counted[r] = true
+				counts[key{j.QUEUE, r}]++
+			}
+		}
+	}
+	for k, n := range counts {
+		ch <- prometheus.MustNewConstMetric(c.PendingReason, prometheus.GaugeValue, n, k.queue, k.reason)
+	}
+
+	return nil
+}
@@ -0,0 +1,226 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+
+	"lsf_exporter/config"
+)
+
+// commandWaitDelay bounds how long we wait for the output pipes of a killed
+// command to be closed, in case a grandchild escaped its process group.
+const commandWaitDelay = 2 * time.Second
+
+// ExecRunner is the config.CommandRunner used in production. It runs LSF
+// commands as child processes of the exporter.
+type ExecRunner struct {
+	logger *slog.Logger
+	env    *Environment
+}
+
+// NewExecRunner returns an ExecRunner logging to logger. Commands are looked
+// up and run in env, or in the exporter's own environment when env is nil.
+func NewExecRunner(logger *slog.Logger, env *Environment) *ExecRunner {
+	return &ExecRunner{logger: logger, env: env}
+}
+
+// Run runs an LSF command and returns its standard output. The command is
+// started in its own process group, and the whole group is killed when ctx is
+// cancelled or its deadline expires.
+func (r *ExecRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	path := name
+	if r.env != nil {
+		var err error
+		if path, err = r.env.LookPath(name); err != nil {
+			cmdErr := &CommandError{
+				Command:  commandLine(name, args...),
+				ExitCode: -1,
+				Kind:     ErrorKindNotFound,
+				Reason:   "command_not_found",
+				Err:      err,
+			}
+			observeCommandFailure(name, cmdErr)
+			return nil, cmdErr
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, path, args...)
+	if r.env != nil {
+		cmd.Env = r.env.Environ()
+	}
+	setProcessGroup(cmd)
+	cmd.WaitDelay = commandWaitDelay
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	begin := time.Now()
+	err := cmd.Run()
+	duration := time.Since(begin)
+	commandDurationSeconds.WithLabelValues(name).Observe(duration.Seconds())
+	r.logger.Debug("LSF command finished", "command", name, "duration", duration.Seconds())
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		// A cancelled scrape, such as a client going away, is not a timeout.
+		kind, reason := ErrorKindTimeout, "timeout"
+		if !errors.Is(ctxErr, context.DeadlineExceeded) {
+			kind, reason = ErrorKindCanceled, "canceled"
+		}
+		cmdErr := &CommandError{
+			Command:  commandLine(name, args...),
+			ExitCode: -1,
+			Stderr:   stderr.String(),
+			Kind:     kind,
+			Reason:   reason,
+			Err:      ctxErr,
+		}
+		observeCommandFailure(name, cmdErr)
+		return nil, cmdErr
+	}
+	if err != nil {
+		exitCode := -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		}
+		// The standard output may hold job names or descriptions matching
+		// the catalogue, so it is only searched when stderr is empty.
+		output := stderr.String()
+		if strings.TrimSpace(output) == "" {
+			output = stdout.String()
+		}
+		lsfErr := lookupError(output)
+		cmdErr := &CommandError{
+			Command:     commandLine(name, args...),
+			ExitCode:    exitCode,
+			Stderr:      stderr.String(),
+			Kind:        lsfErr.Kind,
+			Reason:      lsfErr.Reason,
+			Description: lsfErr.Description,
+			Err:         err,
+		}
+		observeCommandFailure(name, cmdErr)
+		return nil, cmdErr
+	}
+
+	commandOutputBytes.WithLabelValues(name).Set(float64(stdout.Len()))
+	return stdout.Bytes(), nil
+}
+
+// observeCommandFailure counts a failed LSF command.
+func observeCommandFailure(name string, err *CommandError) {
+	commandErrorsTotal.WithLabelValues(name, err.Reason).Inc()
+	commandFailuresTotal.WithLabelValues(name, string(err.Kind)).Inc()
+}
+
+// ErrorKind classifies the failures of LSF commands. It is used as the name
+// label of lsf_scrape_error.
+type ErrorKind string
+
+const (
+	ErrorKindLSFDown              ErrorKind = "lsf_down"
+	ErrorKindLIMUnreachable       ErrorKind = "lim_unreachable"
+	ErrorKindMbatchdNotResponding ErrorKind = "mbatchd_not_responding"
+	ErrorKindNoJobs               ErrorKind = "no_jobs"
+	ErrorKindTimeout              ErrorKind = "timeout"
+	ErrorKindCanceled             ErrorKind = "canceled"
+	ErrorKindNotFound             ErrorKind = "command_not_found"
+	ErrorKindParse                ErrorKind = "parse"
+	ErrorKindUnknown              ErrorKind = "unknown"
+)
+
+// CommandError describes an LSF command that failed.
+type CommandError struct {
+	// Command is the command line that was run.
+	Command string
+	// ExitCode is the exit status of the command, -1 if it did not exit.
+	ExitCode int
+	Stderr   string
+	Kind     ErrorKind
+	// Reason and Description come from the LSF error catalogue.
+	Reason      string
+	Description string
+	Err         error
+}
+
+func (e *CommandError) Error() string {
+	msg := fmt.Sprintf("error while calling '%s': %v (%s)", e.Command, e.Err, e.Reason)
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// ParseError reports LSF command output that could not be parsed.
+type ParseError struct {
+	Command string
+	Err     error
+}
+
+// newParseError returns a ParseError for the output of command, and counts
+// it against collector.
+func newParseError(collector, command string, err error) *ParseError {
+	parseErrorsTotal.WithLabelValues(collector).Inc()
+	return &ParseError{Command: command, Err: err}
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("couldn't parse '%s' output: %v", e.Command, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// errorKind returns the kind of err, as reported by lsf_scrape_error.
+func errorKind(err error) ErrorKind {
+	var cmdErr *CommandError
+	var parseErr *ParseError
+	switch {
+	case errors.As(err, &cmdErr):
+		return cmdErr.Kind
+	case errors.As(err, &parseErr):
+		return ErrorKindParse
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorKindTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorKindCanceled
+	default:
+		return ErrorKindUnknown
+	}
+}
+
+// isErrorKind reports whether err is a CommandError of the given kind.
+func isErrorKind(err error, kind ErrorKind) bool {
+	var cmdErr *CommandError
+	return errors.As(err, &cmdErr) && cmdErr.Kind == kind
+}
+
+// newCommandRunner returns the runner configured in cfg, or an ExecRunner
+// when none is set.
+func newCommandRunner(logger *slog.Logger, cfg *config.Configuration) config.CommandRunner {
+	if cfg != nil && cfg.Runner != nil {
+		return cfg.Runner
+	}
+	return NewExecRunner(logger, nil)
+}
+
+// commandLine formats a command and its arguments the way they would be
+// typed in a shell, without any quoting.
+func commandLine(name string, args ...string) string {
+	return strings.Join(append([]string{name}, args...), " ")
+}
@@ -0,0 +1,97 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestExecRunnerClassifiesFailures(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho 'LSF is down. Please wait ...' >&2\nexit 255\n"
+	if err := os.WriteFile(filepath.Join(dir, "bhosts"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewExecRunner(slog.New(slog.NewTextHandler(io.Discard, nil)), &Environment{BinDir: dir})
+	_, err := r.Run(context.Background(), "bhosts", "-w")
+
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		t.Fatalf("expected a CommandError, got %v", err)
+	}
+	if cmdErr.Kind != ErrorKindLSFDown || cmdErr.Reason != "lsf_down" || cmdErr.ExitCode != 255 || cmdErr.Command != "bhosts -w" {
+		t.Errorf("unexpected error %+v", cmdErr)
+	}
+	if errorKind(err) != ErrorKindLSFDown {
+		t.Errorf("expected kind %s, got %s", ErrorKindLSFDown, errorKind(err))
+	}
+}
+
+func TestExecRunnerClassifiesFromStderr(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+
+	for _, tc := range []struct {
+		name, script string
+		kind         ErrorKind
+	}{
+		{
+			name:   "stderr",
+			script: "#!/bin/sh\necho 'JOBID JOB_NAME'\necho '1 \"LSF is down\" drill'\necho 'Cannot connect to LIM' >&2\nexit 255\n",
+			kind:   ErrorKindLIMUnreachable,
+		},
+		{
+			name:   "stdout",
+			script: "#!/bin/sh\necho 'LSF is down. Please wait ...'\nexit 255\n",
+			kind:   ErrorKindLSFDown,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "bjobs"), []byte(tc.script), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			r := NewExecRunner(slog.New(slog.NewTextHandler(io.Discard, nil)), &Environment{BinDir: dir})
+			_, err := r.Run(context.Background(), "bjobs", "-w")
+			if errorKind(err) != tc.kind {
+				t.Errorf("expected kind %s, got %s (%v)", tc.kind, errorKind(err), err)
+			}
+		})
+	}
+}
+
+func TestExecRunnerTellsTimeoutFromCancellation(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "bjobs"), []byte("#!/bin/sh\nsleep 5\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	r := NewExecRunner(slog.New(slog.NewTextHandler(io.Discard, nil)), &Environment{BinDir: dir})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := r.Run(ctx, "bjobs"); errorKind(err) != ErrorKindTimeout {
+		t.Errorf("expected kind %s, got %s (%v)", ErrorKindTimeout, errorKind(err), err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if _, err := r.Run(ctx, "bjobs"); errorKind(err) != ErrorKindCanceled {
+		t.Errorf("expected kind %s, got %s (%v)", ErrorKindCanceled, errorKind(err), err)
+	}
+}
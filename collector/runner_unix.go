@@ -0,0 +1,27 @@
+//go:build !windows
+
+package collector
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup places cmd in a new process group and makes context
+// cancellation kill the whole group, so that helpers forked by the LSF
+// commands do not outlive a timed out scrape.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// fileID returns the inode of a file, which identifies it across renames.
+func fileID(fi os.FileInfo) uint64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
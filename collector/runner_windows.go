@@ -0,0 +1,16 @@
+//go:build windows
+
+package collector
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup is a no-op on Windows, where exec.CommandContext already
+// kills the started process on cancellation.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// fileID returns 0 on Windows, where files are only told apart by
+// os.SameFile while the exporter runs.
+func fileID(fi os.FileInfo) uint64 { return 0 }
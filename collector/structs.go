@@ -91,30 +91,99 @@ type lshostsInfo struct {
 }
 
 type bjobsInfo struct {
-	JOBID       string `json:"JOBID"`
-	USER        string `json:"USER"`
-	STATUS      string `json:"STAT"`
-  QUEUE       string `json:"QUEUE"`
-	FROM_HOST   string `json:"FROM_HOST"`
-	EXEC_HOST   string `json:"EXEC_HOST"`
-	JOB_NAME    string `json:"JOB_NAME"`
-	SUBMIT_TIME string `json:"SUBMIT_TIME"`
-	UGROUP      string `json:"UGROUP"`
-	PROJECT     string `json:"PROJ_NAME"`
-	APPLICATION string `json:"APPLICATION"`
-	JOB_GROUP   string `json:"JOB_GROUP"`
-	DEPENDENCY  string `json:"DEPENDENCY"`
-	NALLOC_SLOT string `json:"NALLOC_SLOT"`
-	MIN_REQ_PROC string `json:"MIN_REQ_PROC"`
-	START_TIME  string `json:"START_TIME"`
-	SUB_CWD     string `json:"SUB_CWD"`
-	PEND_TIME   string `json:"PEND_TIME"`
-	EPENDTIME   string `json:"EPENDTIME"`
-	IPENDTIME   string `json:"IPENDTIME"`
-	SRCJOBID    string `json:"SRCJOBID"`
-	DSTJOBID    string `json:"DSTJOBID"`
-	SRCCLUSTER  string `json:"SOURCE_CLUSTER"`
-	DSTCLUSTER  string `json:"FORWARD_CLUSTER"`
+	JOBID            string `json:"JOBID"`
+	USER             string `json:"USER"`
+	STATUS           string `json:"STAT"`
+	QUEUE            string `json:"QUEUE"`
+	FROM_HOST        string `json:"FROM_HOST"`
+	EXEC_HOST        string `json:"EXEC_HOST"`
+	JOB_NAME         string `json:"JOB_NAME"`
+	SUBMIT_TIME      string `json:"SUBMIT_TIME"`
+	UGROUP           string `json:"UGROUP"`
+	PROJECT          string `json:"PROJ_NAME"`
+	APPLICATION      string `json:"APPLICATION"`
+	JOB_GROUP        string `json:"JOB_GROUP"`
+	DEPENDENCY       string `json:"DEPENDENCY"`
+	NALLOC_SLOT      string `json:"NALLOC_SLOT"`
+	MIN_REQ_PROC     string `json:"MIN_REQ_PROC"`
+	START_TIME       string `json:"START_TIME"`
+	SUB_CWD          string `json:"SUB_CWD"`
+	PEND_TIME        string `json:"PEND_TIME"`
+	EPENDTIME        string `json:"EPENDTIME"`
+	IPENDTIME        string `json:"IPENDTIME"`
+	SRCJOBID         string `json:"SRCJOBID"`
+	DSTJOBID         string `json:"DSTJOBID"`
+	SRCCLUSTER       string `json:"SOURCE_CLUSTER"`
+	DSTCLUSTER       string `json:"FORWARD_CLUSTER"`
+	MEM              string `json:"MEM"`
+	MAX_MEM          string `json:"MAX_MEM"`
+	AVG_MEM          string `json:"AVG_MEM"`
+	SWAP             string `json:"SWAP"`
+	CPU_USED         string `json:"CPU_USED"`
+	RUN_TIME         string `json:"RUN_TIME"`
+	MEMLIMIT         string `json:"MEMLIMIT"`
+	RUNTIMELIMIT     string `json:"RUNTIMELIMIT"`
+	EFFECTIVE_RESREQ string `json:"EFFECTIVE_RESREQ"`
+	PEND_REASON      string `json:"PEND_REASON"`
+	JOBINDEX         string `json:"JOBINDEX"`
+	EXIT_CODE        string `json:"EXIT_CODE"`
+	EXIT_REASON      string `json:"EXIT_REASON"`
+	ERROR            string `json:"ERROR"`
+}
+
+// 以下是bjobs -A命令的struct
+type bjobsArrayInfo struct {
+	JOBID      string  `csv:"JOBID"`
+	ARRAY_SPEC string  `csv:"ARRAY_SPEC"`
+	OWNER      string  `csv:"OWNER"`
+	NJOBS      float64 `csv:"NJOBS"`
+	PEND       float64 `csv:"PEND"`
+	DONE       float64 `csv:"DONE"`
+	RUN        float64 `csv:"RUN"`
+	EXIT       float64 `csv:"EXIT"`
+	SSUSP      float64 `csv:"SSUSP"`
+	USUSP      float64 `csv:"USUSP"`
+	PSUSP      float64 `csv:"PSUSP"`
+}
+
+// 以下是bjgroup -s命令的struct
+type bjgroupInfo struct {
+	GROUP_NAME string  `csv:"GROUP_NAME"`
+	NJOBS      float64 `csv:"NJOBS"`
+	PEND       float64 `csv:"PEND"`
+	RUN        float64 `csv:"RUN"`
+	SSUSP      float64 `csv:"SSUSP"`
+	USUSP      float64 `csv:"USUSP"`
+	FINISH     float64 `csv:"FINISH"`
+	SLA        string  `csv:"SLA"`
+	JLIMIT     string  `csv:"JLIMIT"`
+	OWNER      string  `csv:"OWNER"`
+}
+
+// 以下是bjgroup -N命令的struct
+type bjgroupSlotsInfo struct {
+	GROUP_NAME string  `csv:"GROUP_NAME"`
+	NSLOTS     float64 `csv:"NSLOTS"`
+	PEND       float64 `csv:"PEND"`
+	RUN        float64 `csv:"RUN"`
+	SSUSP      float64 `csv:"SSUSP"`
+	USUSP      float64 `csv:"USUSP"`
+	RSV        float64 `csv:"RSV"`
+	SLA        string  `csv:"SLA"`
+	OWNER      string  `csv:"OWNER"`
+}
+
+// 以下是busers命令的struct
+type busersInfo struct {
+	USER_GROUP string `csv:"USER/GROUP"`
+	JL_P       string `csv:"JL/P"`
+	MAX        string `csv:"MAX"`
+	NJOBS      string `csv:"NJOBS"`
+	PEND       string `csv:"PEND"`
+	RUN        string `csv:"RUN"`
+	SSUSP      string `csv:"SSUSP"`
+	USUSP      string `csv:"USUSP"`
+	RSV        string `csv:"RSV"`
 }
 
 type csv_bjobsInfo struct {
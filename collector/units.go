@@ -0,0 +1,129 @@
+package collector
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// lsfQuantityRegex splits a value printed by LSF into its number and unit,
+// as in "1.2 Gbytes" or "123 second(s)".
+var lsfQuantityRegex = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)\s*([A-Za-z()]*)$`)
+
+// rusageMemRegex extracts the memory reservation from a resource
+// requirement string, as in "rusage[mem=4096.00:duration=10]".
+var rusageMemRegex = regexp.MustCompile(`rusage\[[^\]]*?\bmem=([0-9]+(?:\.[0-9]+)?)\s*([A-Za-z]*)`)
+
+// memoryUnits maps the memory units printed by LSF to bytes.
+var memoryUnits = map[string]float64{
+	"b": 1, "bytes": 1,
+	"k": 1 << 10, "kb": 1 << 10, "kbytes": 1 << 10,
+	"m": 1 << 20, "mb": 1 << 20, "mbytes": 1 << 20,
+	"g": 1 << 30, "gb": 1 << 30, "gbytes": 1 << 30,
+	"t": 1 << 40, "tb": 1 << 40, "tbytes": 1 << 40,
+	"p": 1 << 50, "pb": 1 << 50, "pbytes": 1 << 50,
+}
+
+// durationUnits maps the time units printed by LSF to seconds.
+var durationUnits = map[string]float64{
+	"s": 1, "sec": 1, "second": 1, "seconds": 1, "second(s)": 1,
+	"m": 60, "min": 60, "minute": 60, "minutes": 60, "minute(s)": 60,
+	"h": 3600, "hour": 3600, "hours": 3600, "hour(s)": 3600,
+}
+
+// parseLSFMemory parses a memory amount such as "1.2 Gbytes" or "4 G" into
+// bytes. Values without a unit are in KB, the default of
+// LSF_UNIT_FOR_LIMITS. It returns false for empty values and "-".
+func parseLSFMemory(s string) (float64, bool) {
+	value, unit, ok := splitLSFQuantity(s)
+	if !ok {
+		return 0, false
+	}
+	if unit == "" {
+		return value * memoryUnits["kb"], true
+	}
+	factor, ok := memoryUnits[unit]
+	if !ok {
+		return 0, false
+	}
+	return value * factor, true
+}
+
+// parseRusageMem returns the memory reserved by the first rusage[mem=...]
+// of a resource requirement string, in bytes. Values without a unit are in
+// MB, the unit of resource requirements by default.
+func parseRusageMem(resreq string) (float64, bool) {
+	m := rusageMemRegex.FindStringSubmatch(resreq)
+	if m == nil {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	if m[2] == "" {
+		return value * memoryUnits["mb"], true
+	}
+	factor, ok := memoryUnits[strings.ToLower(m[2])]
+	if !ok {
+		return 0, false
+	}
+	return value * factor, true
+}
+
+// parseLSFDuration parses a duration such as "123 second(s)", "60.0 min",
+// "00:12:34" (hours:minutes:seconds) or "1:30" (hours:minutes) into seconds.
+// Numbers without a unit are counted in defaultUnit seconds. A trailing
+// normalization host, as in "60.0/hostA", is ignored. It returns false for
+// empty values and "-".
+func parseLSFDuration(s string, defaultUnit float64) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if i := strings.Index(s, "/"); i >= 0 {
+		s = s[:i]
+	}
+
+	if strings.Contains(s, ":") {
+		parts := strings.Split(s, ":")
+		if len(parts) > 3 {
+			return 0, false
+		}
+		var seconds float64
+		for _, p := range parts {
+			v, err := strconv.ParseFloat(p, 64)
+			if err != nil {
+				return 0, false
+			}
+			seconds = seconds*60 + v
+		}
+		if len(parts) == 2 {
+			seconds *= 60
+		}
+		return seconds, true
+	}
+
+	value, unit, ok := splitLSFQuantity(s)
+	if !ok {
+		return 0, false
+	}
+	if unit == "" {
+		return value * defaultUnit, true
+	}
+	factor, ok := durationUnits[unit]
+	if !ok {
+		return 0, false
+	}
+	return value * factor, true
+}
+
+// splitLSFQuantity returns the number and the lower-cased unit of s.
+func splitLSFQuantity(s string) (float64, string, bool) {
+	m := lsfQuantityRegex.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, "", false
+	}
+	value, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return value, strings.ToLower(m[2]), true
+}
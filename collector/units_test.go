@@ -0,0 +1,69 @@
+package collector
+
+import "testing"
+
+func TestParseLSFMemory(t *testing.T) {
+	for in, want := range map[string]float64{
+		"1.5 Gbytes": 1.5 * (1 << 30),
+		"512 Mbytes": 512 << 20,
+		"4 G":        4 << 30,
+		"2048":       2048 << 10,
+		"100 Kbytes": 100 << 10,
+		"7 bytes":    7,
+	} {
+		got, ok := parseLSFMemory(in)
+		if !ok || got != want {
+			t.Errorf("parseLSFMemory(%q) = %v, %v; want %v", in, got, ok, want)
+		}
+	}
+	for _, in := range []string{"", "-", "1 Zbytes", "lots"} {
+		if _, ok := parseLSFMemory(in); ok {
+			t.Errorf("parseLSFMemory(%q) should fail", in)
+		}
+	}
+}
+
+func TestParseLSFDuration(t *testing.T) {
+	for _, tc := range []struct {
+		in          string
+		defaultUnit float64
+		want        float64
+	}{
+		{"123 second(s)", 1, 123},
+		{"0.5 sec", 1, 0.5},
+		{"00:12:34", 1, 754},
+		{"25:00:00", 1, 90000},
+		{"1:30", 1, 5400},
+		{"60.0 min", 1, 3600},
+		{"1440.0/node001", 60, 86400},
+		{"90", 60, 5400},
+	} {
+		got, ok := parseLSFDuration(tc.in, tc.defaultUnit)
+		if !ok || got != tc.want {
+			t.Errorf("parseLSFDuration(%q, %v) = %v, %v; want %v", tc.in, tc.defaultUnit, got, ok, tc.want)
+		}
+	}
+	for _, in := range []string{"", "-", "1:2:3:4", "12 fortnights"} {
+		if _, ok := parseLSFDuration(in, 1); ok {
+			t.Errorf("parseLSFDuration(%q) should fail", in)
+		}
+	}
+}
+
+func TestParseRusageMem(t *testing.T) {
+	for in, want := range map[string]float64{
+		"select[type == local] order[r15s:pg] rusage[mem=4096.00] span[hosts=1]": 4096 << 20,
+		"rusage[ut=0.5:mem=8GB:duration=10]":                                     8 << 30,
+		"rusage[mem=512,swp=100]":                                                512 << 20,
+	} {
+		got, ok := parseRusageMem(in)
+		if !ok || got != want {
+			t.Errorf("parseRusageMem(%q) = %v, %v; want %v", in, got, ok, want)
+		}
+	}
+	for _, in := range []string{"", "select[type == local]", "rusage[swp=100]"} {
+		if _, ok := parseRusageMem(in); ok {
+			t.Errorf("parseRusageMem(%q) should fail", in)
+		}
+	}
+}
@@ -1,5 +1,5 @@
-// Package config includes all individual types and functions to gather
-// the monitored licenses.
+// Package config includes all individual types and functions to load the
+// exporter configuration.
 // (C) Copyright 2017 Mario Trangoni.
 // Licensed under the Apache License, Version 2.0 (the "License");
 // you may not use this file except in compliance with the License.
@@ -15,57 +15,191 @@
 package config
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"time"
 
-	"github.com/go-kit/log"
-	"github.com/go-kit/log/level"
 	"gopkg.in/yaml.v3"
 )
 
 // YAML Type definitions
 
-// License individual configuration type.
-type License struct {
-	Name                string `yaml:"name"`
-	LicenseFile         string `yaml:"license_file,omitempty"`
-	LicenseServer       string `yaml:"license_server,omitempty"`
-	FeaturesToExclude   string `yaml:"features_to_exclude,omitempty"`
-	FeaturesToInclude   string `yaml:"features_to_include,omitempty"`
-	MonitorUsers        bool   `yaml:"monitor_users"`
-	MonitorReservations bool   `yaml:"monitor_reservations"`
-	MonitorVersions     bool   `yaml:"monitor_versions,omitempty"`
+// LSF holds the LSF directories, as LSF_BINDIR, LSF_SERVERDIR, LSF_ENVDIR
+// and LSF_LIBDIR, and the profile.lsf to complete them from.
+type LSF struct {
+	BinDir    string `yaml:"bindir,omitempty"`
+	ServerDir string `yaml:"serverdir,omitempty"`
+	EnvDir    string `yaml:"envdir,omitempty"`
+	LibDir    string `yaml:"libdir,omitempty"`
+	Profile   string `yaml:"profile,omitempty"`
+}
+
+// Collector holds the settings of one collector. Unset fields keep the
+// value of the command-line flags.
+type Collector struct {
+	Enabled  *bool          `yaml:"enabled,omitempty"`
+	Timeout  *time.Duration `yaml:"timeout,omitempty"`
+	Interval *time.Duration `yaml:"interval,omitempty"`
+}
+
+// Labels holds options for the labels of the exported metrics.
+type Labels struct {
+	// Extra labels added to every metric of the LSF collectors.
+	Extra map[string]string `yaml:"extra,omitempty"`
+	// UnknownSolver is the solver label of jobs missing from the solver
+	// mapping. Defaults to "unknown".
+	UnknownSolver string `yaml:"unknown_solver,omitempty"`
+}
+
+// Jobs holds the options of the lsfjob collector.
+type Jobs struct {
+	// PerJob exports the lsf_bjobs_* series of every job. Defaults to true.
+	PerJob *bool `yaml:"per_job,omitempty"`
+	// Labels lists the bjobs fields, such as JOBID or SUB_CWD, that become
+	// labels of the per-job metrics. Defaults to all of them.
+	Labels []string `yaml:"labels,omitempty"`
+	// Aggregate exports job counts, slot sums and pending time summaries
+	// grouped by the labels of AggregateBy.
+	Aggregate   bool     `yaml:"aggregate,omitempty"`
+	AggregateBy []string `yaml:"aggregate_by,omitempty"`
+	// RusageMemPerSlot tells that rusage[mem=...] reserves memory per slot
+	// rather than per job, for the memory efficiency of jobs.
+	RusageMemPerSlot bool `yaml:"rusage_mem_per_slot,omitempty"`
+	// PendingTimeBuckets are the upper bounds of the buckets of the pending
+	// time histograms.
+	PendingTimeBuckets []time.Duration `yaml:"pending_time_buckets,omitempty"`
+	// PendingReasonsLimit caps the number of distinct pending reasons of
+	// the pending_reason collector. The others are counted as "other".
+	PendingReasonsLimit int `yaml:"pending_reasons_limit,omitempty"`
+	// CollapseArrays leaves the elements of job arrays out of the per-job
+	// series, which the job array metrics sum up.
+	CollapseArrays bool `yaml:"collapse_arrays,omitempty"`
+}
+
+// LogFile holds the options of a collector reading a file of the mbatchd
+// log directory.
+type LogFile struct {
+	// File is the path of the file. Defaults to the file of the
+	// $LSB_SHAREDIR/<cluster_name>/logdir directory.
+	File string `yaml:"file,omitempty"`
+	// StateFile keeps the read offset across restarts. When empty, the
+	// offset is only kept in memory.
+	StateFile string `yaml:"state_file,omitempty"`
+	// FromBeginning reads a file never read before from its start, rather
+	// than from its end.
+	FromBeginning bool `yaml:"from_beginning,omitempty"`
+}
+
+// Events holds the options of the events collector.
+type Events struct {
+	LogFile `yaml:",inline"`
+	// Stream reads lsb.stream, written when ENABLE_EVENT_STREAM is set in
+	// lsb.params, rather than lsb.events.
+	Stream bool `yaml:"stream,omitempty"`
 }
 
 type CliOpts struct {
 	LsfStdSolverConfig string
+	// LSF directories, as LSF_BINDIR, LSF_SERVERDIR, LSF_ENVDIR and LSF_LIBDIR.
+	LsfBinDir    string
+	LsfServerDir string
+	LsfEnvDir    string
+	LsfLibDir    string
+	// LsfProfile is the path of a profile.lsf to read the LSF environment from.
+	LsfProfile string
+}
+
+// CommandRunner runs an LSF command and returns its standard output.
+type CommandRunner interface {
+	Run(ctx context.Context, name string, args ...string) ([]byte, error)
 }
 
-// Configuration type for all licenses.
+// Configuration type for the exporter, loaded from the YAML file given with
+// --config.file and completed by the command-line flags.
 type Configuration struct {
-	Licenses []License `yaml:"licenses"`
-	CliOpts  CliOpts
+	LSF LSF `yaml:"lsf,omitempty"`
+	// SolverMapping is the path of the solver standardization mapping file.
+	SolverMapping string `yaml:"solver_mapping,omitempty"`
+	// ClusterName overrides the cluster name reported by lsid.
+	ClusterName string `yaml:"cluster_name,omitempty"`
+	Labels      Labels `yaml:"labels,omitempty"`
+	Jobs        Jobs   `yaml:"jobs,omitempty"`
+	// Accounting configures the acct collector, which reads lsb.acct.
+	Accounting LogFile `yaml:"accounting,omitempty"`
+	// Events configures the events collector, which reads lsb.events.
+	Events Events `yaml:"events,omitempty"`
+	// CollectorDefaults applies to every collector, like --collector.timeout
+	// and --collector.interval.
+	CollectorDefaults Collector            `yaml:"collector_defaults,omitempty"`
+	Collectors        map[string]Collector `yaml:"collectors,omitempty"`
+
+	// CliOpts holds the effective settings, after merging the flags.
+	CliOpts CliOpts `yaml:"-"`
+	// SolverMap is the solver mapping read from CliOpts.LsfStdSolverConfig.
+	// When nil, collectors read the file themselves.
+	SolverMap map[string]string `yaml:"-"`
+	// Runner executes the LSF commands of the collectors. When nil, the
+	// commands are run as child processes of the exporter.
+	Runner CommandRunner `yaml:"-"`
 }
 
-// Load parses the YAML file.
-func Load(filename string, logger log.Logger) (Configuration, error) {
-	level.Info(logger).Log("msg", "Loading license config file:")
-	level.Info(logger).Log(" - ", filename)
+// Load parses the YAML file. Unknown keys are rejected.
+func Load(filename string, logger *slog.Logger) (Configuration, error) {
+	logger.Info("Loading config file", "file", filename)
 
-	bytes, err := os.ReadFile(filepath.Clean(filename))
+	content, err := os.ReadFile(filepath.Clean(filename))
 	if err != nil {
 		return Configuration{}, fmt.Errorf("failed to read %s: %w", filename, err)
 	}
 
 	var c Configuration
 
-	err = yaml.Unmarshal(bytes, &c)
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.KnownFields(true)
+	if err := dec.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+		return Configuration{}, fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
 
-	if err != nil {
-		level.Error(logger).Log("Couldn't load config file: ", err)
-		return c, err
+	if err := c.validate(); err != nil {
+		return Configuration{}, fmt.Errorf("invalid configuration in %s: %w", filename, err)
 	}
 
 	return c, nil
 }
+
+func (c *Configuration) validate() error {
+	durations := map[string]*time.Duration{
+		"collector_defaults.timeout":  c.CollectorDefaults.Timeout,
+		"collector_defaults.interval": c.CollectorDefaults.Interval,
+	}
+	if c.CollectorDefaults.Enabled != nil {
+		return errors.New("collector_defaults.enabled is not supported, use --collector.disable-defaults")
+	}
+	for name, cc := range c.Collectors {
+		durations["collectors."+name+".timeout"] = cc.Timeout
+		durations["collectors."+name+".interval"] = cc.Interval
+	}
+	for key, d := range durations {
+		if d != nil && *d < 0 {
+			return fmt.Errorf("%s must not be negative", key)
+		}
+	}
+	if c.Jobs.PendingReasonsLimit < 0 {
+		return errors.New("jobs.pending_reasons_limit must not be negative")
+	}
+	for i, b := range c.Jobs.PendingTimeBuckets {
+		if b <= 0 {
+			return errors.New("jobs.pending_time_buckets must be positive")
+		}
+		if i > 0 && b <= c.Jobs.PendingTimeBuckets[i-1] {
+			return errors.New("jobs.pending_time_buckets must be in increasing order")
+		}
+	}
+	return nil
+}
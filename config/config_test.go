@@ -0,0 +1,90 @@
+package config
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "lsf_exporter.yml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	path := writeConfig(t, `
+lsf:
+  bindir: /soft/LSF/bin
+solver_mapping: /etc/solvers.csv
+cluster_name: cluster1
+labels:
+  extra:
+    site: hq
+events:
+  file: /soft/LSF/work/cluster1/logdir/lsb.events
+  stream: true
+collectors:
+  lsfjob:
+    enabled: false
+    timeout: 1m
+`)
+	c, err := Load(path, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.LSF.BinDir != "/soft/LSF/bin" || c.SolverMapping != "/etc/solvers.csv" || c.ClusterName != "cluster1" {
+		t.Errorf("unexpected configuration: %+v", c)
+	}
+	if c.Labels.Extra["site"] != "hq" {
+		t.Errorf("expected extra label site=hq, got %v", c.Labels.Extra)
+	}
+	if c.Events.File != "/soft/LSF/work/cluster1/logdir/lsb.events" || !c.Events.Stream {
+		t.Errorf("unexpected events settings: %+v", c.Events)
+	}
+	job := c.Collectors["lsfjob"]
+	if job.Enabled == nil || *job.Enabled || job.Timeout == nil || *job.Timeout != time.Minute {
+		t.Errorf("unexpected lsfjob settings: %+v", job)
+	}
+
+	if _, err := Load(writeConfig(t, ""), logger); err != nil {
+		t.Errorf("empty file: %v", err)
+	}
+}
+
+func TestLoadRejectsInvalidFiles(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	for content, want := range map[string]string{
+		"lsf:\n  bin_dir: /soft/LSF/bin\n":          "field bin_dir not found",
+		"collectors:\n  bjobs:\n    timeout: -1s\n": "collectors.bjobs.timeout must not be negative",
+		"collector_defaults:\n  enabled: false\n":   "collector_defaults.enabled",
+		"collector_defaults:\n  interval: soon\n":   "failed to parse",
+	} {
+		_, err := Load(writeConfig(t, content), logger)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: expected an error containing %q, got %v", content, want, err)
+		}
+	}
+}
+
+func TestLoadExample(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	c, err := Load(filepath.Join("..", "custom", "config", "lsf_exporter.yml"), logger)
+	if err != nil {
+		t.Fatalf("the example configuration doesn't load: %v", err)
+	}
+	if n := len(c.Jobs.PendingTimeBuckets); n == 0 || c.Jobs.PendingTimeBuckets[n-1] != 72*time.Hour {
+		t.Errorf("unexpected pending time buckets %v", c.Jobs.PendingTimeBuckets)
+	}
+}
@@ -23,7 +23,10 @@ import (
 	"os/user"
 	"runtime"
 	"sort"
+	"strconv"
+	"sync"
 	"log/slog"
+	"time"
 
 	"github.com/prometheus/common/promlog"
 	"github.com/prometheus/common/promlog/flag"
@@ -44,29 +47,44 @@ import (
 // created on the fly, if filtering is requested. Create instances with
 // newHandler.
 type handler struct {
+	// mtx guards unfilteredHandler and config, which are replaced on reload.
+	mtx               sync.RWMutex
 	unfilteredHandler http.Handler
 	// exporterMetricsRegistry is a separate registry for the metrics about
 	// the exporter itself.
 	exporterMetricsRegistry *prometheus.Registry
 	includeExporterMetrics  bool
 	maxRequests             int
-	logger                  *slog.Logger
-	config                  *config.Configuration
+	// inFlight holds a token for each request being served, so that
+	// maxRequests applies to the unfiltered handler and the handlers created
+	// on the fly alike. It is nil when there is no limit.
+	inFlight chan struct{}
+	// timeoutOffset is subtracted from the scrape timeout announced by
+	// Prometheus to leave time for the response to be sent back.
+	timeoutOffset time.Duration
+	logger        *slog.Logger
+	config        *config.Configuration
 }
 
-func newHandler(includeExporterMetrics bool, maxRequests int, logger *slog.Logger, cfg *config.Configuration) *handler {
+func newHandler(includeExporterMetrics bool, maxRequests int, timeoutOffset time.Duration, logger *slog.Logger, cfg *config.Configuration) *handler {
 	h := &handler{
 		exporterMetricsRegistry: prometheus.NewRegistry(),
 		includeExporterMetrics:  includeExporterMetrics,
 		maxRequests:             maxRequests,
+		timeoutOffset:           timeoutOffset,
 		logger:                  logger,
 		config:                  cfg,
 	}
+	if maxRequests > 0 {
+		h.inFlight = make(chan struct{}, maxRequests)
+	}
 	if h.includeExporterMetrics {
 		h.exporterMetricsRegistry.MustRegister(
 			promcollectors.NewProcessCollector(promcollectors.ProcessCollectorOpts{}),
 			promcollectors.NewGoCollector(),
 		)
+		collector.RegisterExporterMetrics(h.exporterMetricsRegistry)
+		h.exporterMetricsRegistry.MustRegister(configReloadSuccess, configReloadSeconds)
 	}
 	if innerHandler, err := h.innerHandler(h.config); err != nil {
 		panic(fmt.Sprintf("Couldn't create metrics handler: %s", err))
@@ -76,18 +94,62 @@ func newHandler(includeExporterMetrics bool, maxRequests int, logger *slog.Logge
 	return h
 }
 
+// setConfig replaces the configuration of h. The collectors are created
+// again, so that they pick up the new configuration.
+func (h *handler) setConfig(cfg *config.Configuration) error {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	collector.ResetCollectors()
+	innerHandler, err := h.innerHandler(cfg)
+	if err != nil {
+		return err
+	}
+	h.unfilteredHandler = innerHandler
+	h.config = cfg
+	return nil
+}
+
 // ServeHTTP implements http.Handler.
 func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.inFlight != nil {
+		select {
+		case h.inFlight <- struct{}{}:
+			defer func() { <-h.inFlight }()
+		default:
+			http.Error(w, fmt.Sprintf("Limit of concurrent requests reached (%d), try again later.", h.maxRequests), http.StatusServiceUnavailable)
+			return
+		}
+	}
+
 	filters := r.URL.Query()["collect[]"]
 	h.logger.Debug("collect query:", "filters", filters)
 
+	timeout, err := h.scrapeTimeout(r)
+	if err != nil {
+		h.logger.Warn("Couldn't parse scrape timeout:", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(fmt.Sprintf("Couldn't parse scrape timeout: %s", err)))
+		return
+	}
+	if timeout > 0 {
+		// The collectors run under the context of the request.
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+
+	h.mtx.RLock()
 	if len(filters) == 0 {
 		// No filters, use the prepared unfiltered handler.
-		h.unfilteredHandler.ServeHTTP(w, r)
+		unfilteredHandler := h.unfilteredHandler
+		h.mtx.RUnlock()
+		unfilteredHandler.ServeHTTP(w, r)
 		return
 	}
-	// To serve filtered metrics, we create a filtering handler on the fly.
+	// To serve filtered metrics, we create a handler on the fly.
 	filteredHandler, err := h.innerHandler(h.config, filters...)
+	h.mtx.RUnlock()
 	if err != nil {
 		h.logger.Warn("Couldn't create filtered metrics handler:", "err", err)
 		w.WriteHeader(http.StatusBadRequest)
@@ -97,9 +159,29 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	filteredHandler.ServeHTTP(w, r)
 }
 
+// scrapeTimeout returns the time left to answer r, taken from the
+// X-Prometheus-Scrape-Timeout-Seconds header minus the configured offset, or
+// the header value alone when it is not greater than the offset. It returns
+// 0 when the header is absent.
+func (h *handler) scrapeTimeout(r *http.Request) (time.Duration, error) {
+	v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if v == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid X-Prometheus-Scrape-Timeout-Seconds %q: %w", v, err)
+	}
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout > h.timeoutOffset {
+		timeout -= h.timeoutOffset
+	}
+	return timeout, nil
+}
+
 // innerHandler is used to create both the one unfiltered http.Handler to be
 // wrapped by the outer handler and also the filtered handlers created on the
-// fly. The former is accomplished by calling innerHandler without any arguments
+// fly. The former is accomplished by calling innerHandler without filters
 // (in which case it will log all the collectors enabled via command-line
 // flags).
 func (h *handler) innerHandler(config *config.Configuration, filters ...string) (http.Handler, error) {
@@ -125,18 +207,24 @@ func (h *handler) innerHandler(config *config.Configuration, filters ...string)
 
 	r := prometheus.NewRegistry()
 	r.MustRegister(version.NewCollector("lsf_exporter"))
-	if err := r.Register(nc); err != nil {
-		return nil, fmt.Errorf("couldn't register lsf collector: %s", err)
-	}
-	handler := promhttp.HandlerFor(
-		prometheus.Gatherers{h.exporterMetricsRegistry, r},
-		promhttp.HandlerOpts{
-			ErrorLog:            stdlog.New(os.Stderr, "ERROR: ", stdlog.Ldate|stdlog.Ltime|stdlog.Lshortfile),
-			ErrorHandling:       promhttp.ContinueOnError,
-			MaxRequestsInFlight: h.maxRequests,
-			Registry:            h.exporterMetricsRegistry,
+	m := &metricsHandler{
+		collector:   nc,
+		extraLabels: prometheus.Labels(config.Labels.Extra),
+		gatherers:   prometheus.Gatherers{h.exporterMetricsRegistry, r},
+		opts: promhttp.HandlerOpts{
+			ErrorLog:      stdlog.New(os.Stderr, "ERROR: ", stdlog.Ldate|stdlog.Ltime|stdlog.Lshortfile),
+			ErrorHandling: promhttp.ContinueOnError,
+			// The number of requests in flight is limited by ServeHTTP,
+			// across all the handlers.
+			Registry: h.exporterMetricsRegistry,
 		},
-	)
+	}
+	// The lsf collector is registered again for each request, under its
+	// context.
+	if _, err := m.registry(context.Background()); err != nil {
+		return nil, err
+	}
+	var handler http.Handler = m
 	if h.includeExporterMetrics {
 		// Note that we have to use h.exporterMetricsRegistry here to
 		// use the same promhttp metrics for all expositions.
@@ -147,6 +235,49 @@ func (h *handler) innerHandler(config *config.Configuration, filters ...string)
 	return handler, nil
 }
 
+// metricsHandler serves the metrics of an LsfCollector, collected under the
+// context of each request so that its deadline bounds the LSF commands.
+type metricsHandler struct {
+	collector   *collector.LsfCollector
+	extraLabels prometheus.Labels
+	// gatherers hold the metrics that do not depend on the request.
+	gatherers prometheus.Gatherers
+	opts      promhttp.HandlerOpts
+}
+
+// registry returns a registry holding the lsf collector bound to ctx.
+func (m *metricsHandler) registry(ctx context.Context) (*prometheus.Registry, error) {
+	r := prometheus.NewRegistry()
+	var reg prometheus.Registerer = r
+	if len(m.extraLabels) > 0 {
+		reg = prometheus.WrapRegistererWith(m.extraLabels, r)
+	}
+	if err := reg.Register(m.collector.WithContext(ctx)); err != nil {
+		return nil, fmt.Errorf("couldn't register lsf collector: %s", err)
+	}
+	return r, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (m *metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reg, err := m.registry(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	promhttp.HandlerFor(prometheus.Gatherers{m.gatherers, reg}, m.opts).ServeHTTP(w, r)
+}
+
+// flagOrFile returns the value of a flag set on the command line, or else the
+// value from the configuration file, falling back to the flag's default or
+// environment variable when the file leaves it empty.
+func flagOrFile(flagValue string, setByUser bool, fileValue string) string {
+	if setByUser || fileValue == "" {
+		return flagValue
+	}
+	return fileValue
+}
+
 type slogAdapter struct {
 	slog *slog.Logger
 }
@@ -232,12 +363,16 @@ func main() {
 		).Default("/metrics").String()
 		disableExporterMetrics = kingpin.Flag(
 			"web.disable-exporter-metrics",
-			"Exclude metrics about the exporter itself (promhttp_*, process_*, go_*).",
+			"Exclude metrics about the exporter itself (promhttp_*, process_*, go_*, lsf_exporter_*).",
 		).Bool()
 		maxRequests = kingpin.Flag(
 			"web.max-requests",
 			"Maximum number of parallel scrape requests. Use 0 to disable.",
 		).Default("40").Int()
+		timeoutOffset = kingpin.Flag(
+			"web.timeout-offset",
+			"Offset to subtract from the X-Prometheus-Scrape-Timeout-Seconds header.",
+		).Default("500ms").Duration()
 		disableDefaultCollectors = kingpin.Flag(
 			"collector.disable-defaults",
 			"Set all collectors to disabled by default.",
@@ -246,10 +381,40 @@ func main() {
 			"runtime.gomaxprocs", "The target number of CPUs Go will run on (GOMAXPROCS)",
 		).Envar("GOMAXPROCS").Default("1").Int()
 		toolkitFlags = kingpinflag.AddFlags(kingpin.CommandLine, ":9818")
-		lsfStdSolverConfig = kingpin.Flag(
+		configFile   = kingpin.Flag(
+			"config.file",
+			"Path to the YAML configuration file. Command-line flags take precedence over it.",
+		).Default("").String()
+		lsfStdSolverConfigSet bool
+		lsfStdSolverConfig    = kingpin.Flag(
 			"lsf.std-solver-config",
 			"Path to the solver standardization mapping file.",
-		).Default("").String()
+		).Default("").IsSetByUser(&lsfStdSolverConfigSet).String()
+		lsfBinDirSet bool
+		lsfBinDir    = kingpin.Flag(
+			"lsf.bindir",
+			"Directory holding the LSF commands, searched after PATH.",
+		).Envar("LSF_BINDIR").IsSetByUser(&lsfBinDirSet).String()
+		lsfServerDirSet bool
+		lsfServerDir    = kingpin.Flag(
+			"lsf.serverdir",
+			"Directory holding the LSF daemons.",
+		).Envar("LSF_SERVERDIR").IsSetByUser(&lsfServerDirSet).String()
+		lsfEnvDirSet bool
+		lsfEnvDir    = kingpin.Flag(
+			"lsf.envdir",
+			"Directory holding lsf.conf.",
+		).Envar("LSF_ENVDIR").IsSetByUser(&lsfEnvDirSet).String()
+		lsfLibDirSet bool
+		lsfLibDir    = kingpin.Flag(
+			"lsf.libdir",
+			"Directory holding the LSF libraries.",
+		).Envar("LSF_LIBDIR").IsSetByUser(&lsfLibDirSet).String()
+		lsfProfileSet bool
+		lsfProfile    = kingpin.Flag(
+			"lsf.profile",
+			"Path to a profile.lsf whose exported variables complete the LSF environment at startup.",
+		).Default("").IsSetByUser(&lsfProfileSet).String()
 	)
 
 	promlogConfig := &promlog.Config{}
@@ -281,13 +446,56 @@ func main() {
 	runtime.GOMAXPROCS(*maxProcs)
 	logger.Debug("Go MAXPROCS", "procs", runtime.GOMAXPROCS(0))
 
-	cfg := &config.Configuration{
-		CliOpts: config.CliOpts{
-			LsfStdSolverConfig: *lsfStdSolverConfig,
-		},
+	// loadConfig reads the configuration file, completes it with the flags
+	// and loads the solver mapping and the LSF environment it points to. It
+	// runs at startup and on every reload.
+	loadConfig := func() (*config.Configuration, *collector.Environment, error) {
+		cfg := &config.Configuration{}
+		if *configFile != "" {
+			fileCfg, err := config.Load(*configFile, logger)
+			if err != nil {
+				return nil, nil, err
+			}
+			cfg = &fileCfg
+		}
+		cfg.CliOpts = config.CliOpts{
+			LsfStdSolverConfig: flagOrFile(*lsfStdSolverConfig, lsfStdSolverConfigSet, cfg.SolverMapping),
+			LsfBinDir:          flagOrFile(*lsfBinDir, lsfBinDirSet, cfg.LSF.BinDir),
+			LsfServerDir:       flagOrFile(*lsfServerDir, lsfServerDirSet, cfg.LSF.ServerDir),
+			LsfEnvDir:          flagOrFile(*lsfEnvDir, lsfEnvDirSet, cfg.LSF.EnvDir),
+			LsfLibDir:          flagOrFile(*lsfLibDir, lsfLibDirSet, cfg.LSF.LibDir),
+			LsfProfile:         flagOrFile(*lsfProfile, lsfProfileSet, cfg.LSF.Profile),
+		}
+		solverMap, err := collector.LoadSolverMapping(cfg.CliOpts.LsfStdSolverConfig)
+		if err != nil {
+			return nil, nil, err
+		}
+		cfg.SolverMap = solverMap
+		lsfEnv, err := collector.LoadEnvironment(cfg.CliOpts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("couldn't load the LSF environment: %w", err)
+		}
+		return cfg, lsfEnv, nil
 	}
 
-	http.Handle(*metricsPath, newHandler(!*disableExporterMetrics, *maxRequests, logger, cfg))
+	cfg, lsfEnv, err := loadConfig()
+	if err != nil {
+		logger.Error("Couldn't load the configuration", "err", err)
+		os.Exit(1)
+	}
+	if err := applyConfig(cfg, lsfEnv, logger); err != nil {
+		logger.Error("Invalid configuration", "err", err)
+		os.Exit(1)
+	}
+	configReloadSuccess.Set(1)
+	configReloadSeconds.SetToCurrentTime()
+
+	h := newHandler(!*disableExporterMetrics, *maxRequests, *timeoutOffset, logger, cfg)
+	http.Handle(*metricsPath, h)
+
+	reloader := newReloader(loadConfig, h, cfg, logger)
+	reloader.watchSignals()
+	http.Handle("/-/reload", reloader)
 	if *metricsPath != "/" {
 		landingConfig := web.LandingConfig{
 			Name:        "Lsf Exporter",
@@ -302,7 +510,7 @@ func main() {
 		}
 		landingPage, err := web.NewLandingPage(landingConfig)
 		if err != nil {
-			logger.Error("err", err)
+			logger.Error("Couldn't create landing page", "err", err)
 			os.Exit(1)
 		}
 		http.Handle("/", landingPage)
@@ -311,7 +519,7 @@ func main() {
 	server := &http.Server{}
 	adapter := &slogAdapter{slog: logger}
 	if err := web.ListenAndServe(server, toolkitFlags, adapter); err != nil {
-		logger.Error("err", err)
+		logger.Error("Error running HTTP server", "err", err)
 		os.Exit(1)
 	}
 }
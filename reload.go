@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"lsf_exporter/collector"
+	"lsf_exporter/config"
+)
+
+var (
+	configReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "lsf",
+		Subsystem: "exporter",
+		Name:      "config_last_reload_successful",
+		Help:      "Whether the last configuration reload attempt was successful.",
+	})
+	configReloadSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "lsf",
+		Subsystem: "exporter",
+		Name:      "config_last_reload_success_timestamp_seconds",
+		Help:      "Timestamp of the last successful configuration reload.",
+	})
+)
+
+// applyConfig applies the collector settings of cfg, checks that env holds
+// the commands of the enabled collectors and sets the runner of cfg.
+func applyConfig(cfg *config.Configuration, env *collector.Environment, logger *slog.Logger) error {
+	if err := collector.ApplyConfig(cfg); err != nil {
+		return err
+	}
+	if err := env.Validate(collector.EnabledCommands()); err != nil {
+		return fmt.Errorf("the LSF environment is incomplete: %w", err)
+	}
+	logger.Info("LSF environment", "bindir", env.BinDir, "serverdir", env.ServerDir, "envdir", env.EnvDir, "libdir", env.LibDir)
+	cfg.Runner = collector.NewCoalescingRunner(collector.NewExecRunner(logger, env))
+	return nil
+}
+
+// reloader reloads the configuration file and the solver mapping on SIGHUP
+// and on POST /-/reload. A configuration that fails to load or validate is
+// discarded and the previous one is kept.
+type reloader struct {
+	mtx     sync.Mutex
+	load    func() (*config.Configuration, *collector.Environment, error)
+	handler *handler
+	current *config.Configuration
+	logger  *slog.Logger
+}
+
+func newReloader(load func() (*config.Configuration, *collector.Environment, error), h *handler, cfg *config.Configuration, logger *slog.Logger) *reloader {
+	return &reloader{
+		load:    load,
+		handler: h,
+		current: cfg,
+		logger:  logger,
+	}
+}
+
+// reload loads the configuration again and swaps it in.
+func (r *reloader) reload() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.logger.Info("Reloading configuration")
+	err := r.swap()
+	if err != nil {
+		r.logger.Error("Error reloading configuration, keeping the previous one", "err", err)
+		configReloadSuccess.Set(0)
+		return err
+	}
+	r.logger.Info("Configuration reloaded")
+	configReloadSuccess.Set(1)
+	configReloadSeconds.SetToCurrentTime()
+	return nil
+}
+
+func (r *reloader) swap() error {
+	cfg, env, err := r.load()
+	if err != nil {
+		return err
+	}
+	if err := applyConfig(cfg, env, r.logger); err != nil {
+		r.restore()
+		return err
+	}
+	if err := r.handler.setConfig(cfg); err != nil {
+		r.restore()
+		if err := r.handler.setConfig(r.current); err != nil {
+			r.logger.Error("Couldn't restore the previous configuration", "err", err)
+		}
+		return err
+	}
+	r.current = cfg
+	return nil
+}
+
+// restore applies the collector settings of the current configuration again.
+func (r *reloader) restore() {
+	if err := collector.ApplyConfig(r.current); err != nil {
+		r.logger.Error("Couldn't restore the previous collector settings", "err", err)
+	}
+}
+
+// watchSignals reloads the configuration on every SIGHUP.
+func (r *reloader) watchSignals() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			r.reload()
+		}
+	}()
+}
+
+// ServeHTTP implements http.Handler for POST /-/reload.
+func (r *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Only POST requests allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.reload(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to reload config: %s", err), http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte("Configuration reloaded\n"))
+}